@@ -1,19 +1,61 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"log"
+	"time"
 
 	"github.com/VincentBaron/bangr/backend/internal/config"
+	"github.com/VincentBaron/bangr/backend/internal/encryption"
 	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/repositories"
+	"github.com/VincentBaron/bangr/backend/internal/services"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
+// rotateBatchSize is the number of tokens re-encrypted per transaction
+const rotateBatchSize = 100
+
 func main() {
+	flag.Usage = func() {
+		log.Println("Usage: migrate [up | rotate-keys | grant-admin <username>]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
 	// Load environment variables
 	config.LoadEnvVariables()
 
 	// Connect to database
 	config.ConnectToDb()
 
+	switch flag.Arg(0) {
+	case "", "up":
+		migrate()
+	case "rotate-keys":
+		rotateKeys()
+	case "grant-admin":
+		grantAdmin(flag.Arg(1))
+	default:
+		flag.Usage()
+		log.Fatalf("Unknown command %q", flag.Arg(0))
+	}
+}
+
+// migrate updates the schema and backfills the new columns
+func migrate() {
+	// Sets are unique per user and round, the duplicates of the sync are
+	// merged before the index is created
+	if config.DB.Migrator().HasColumn(&models.Set{}, "round_id") &&
+		!config.DB.Migrator().HasIndex(&models.Set{}, "idx_sets_user_round") {
+		log.Println("Merging duplicate sets...")
+		if err := config.DB.Transaction(dedupeSets); err != nil {
+			log.Fatalf("Error merging duplicate sets: %v", err)
+		}
+	}
+
 	// Run migrations
 	log.Println("Running database migrations...")
 	err := config.DB.AutoMigrate(
@@ -23,9 +65,301 @@ func main() {
 		&models.Track{},
 		&models.Like{},
 		&models.Genre{},
+		&models.LeaderboardStanding{},
+		&models.OAuthState{},
+		&models.LoginCode{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.DataExport{},
+		&models.AuditEvent{},
+		&models.LoginAttempt{},
+		&models.RateLimitBucket{},
+		&models.CronRun{},
+		&models.HouseSet{},
+		&models.Round{},
+		&models.RoundSchedule{},
+		&models.RoundResult{},
+		&models.RoundTrackResult{},
+		&models.RoundCuratorResult{},
+		&models.SyncIssue{},
 	)
 	if err != nil {
 		log.Fatalf("Error during migration: %v", err)
 	}
+
+	// Likes are unique per round since a track can be liked again in a later round
+	if config.DB.Migrator().HasIndex(&models.Like{}, "idx_user_track") {
+		log.Println("Dropping the unique index of likes per track...")
+		if err := config.DB.Migrator().DropIndex(&models.Like{}, "idx_user_track"); err != nil {
+			log.Fatalf("Error dropping index: %v", err)
+		}
+	}
+
+	// Turn the dummy sets into house sets, shown to everyone from their creation
+	if config.DB.Migrator().HasColumn(&models.Set{}, "dummy") {
+		log.Println("Converting dummy sets into house sets...")
+		if err := convertDummySets(); err != nil {
+			log.Fatalf("Error converting dummy sets: %v", err)
+		}
+	}
+
+	// Credit likes saved before they referenced a set to the latest set
+	// holding the track at the time of the like
+	log.Println("Backfilling liked sets...")
+	err = config.DB.Exec(`
+		UPDATE likes SET set_id = (
+			SELECT sets.id FROM sets
+			JOIN set_tracks ON set_tracks.set_id = sets.id
+			WHERE set_tracks.track_id = likes.track_id
+				AND sets.created_at <= likes.created_at
+			ORDER BY sets.created_at DESC
+			LIMIT 1
+		)
+		WHERE set_id IS NULL`).Error
+	if err != nil {
+		log.Fatalf("Error backfilling liked sets: %v", err)
+	}
+
+	// Sets created through the API saved the id of the playlist instead of its link
+	log.Println("Backfilling set links...")
+	err = config.DB.Exec(`
+		UPDATE sets SET link = 'https://open.spotify.com/playlist/' || link
+		WHERE link <> '' AND link NOT LIKE 'https://%'`).Error
+	if err != nil {
+		log.Fatalf("Error backfilling set links: %v", err)
+	}
+
+	log.Println("Backfilling rounds...")
+	if err := backfillRounds(); err != nil {
+		log.Fatalf("Error backfilling rounds: %v", err)
+	}
+
+	// Users who signed up before the free tier was introduced were required
+	// to have Premium, the sync job checks them again
+	log.Println("Backfilling user tiers...")
+	err = config.DB.Exec(`
+		UPDATE users SET tier = 'premium'
+		WHERE tier_checked_at IS NULL AND spotify_user_id <> ''`).Error
+	if err != nil {
+		log.Fatalf("Error backfilling user tiers: %v", err)
+	}
 	log.Println("Database migrations completed successfully")
 }
+
+// backfillRounds generates the rounds since the first set and attaches the
+// sets, likes and weekly standings saved before rounds existed to them
+func backfillRounds() error {
+	from := time.Now()
+	var firstSet models.Set
+	err := config.DB.Order("created_at").First(&firstSet).Error
+	if err == nil {
+		from = firstSet.CreatedAt
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	roundService := services.NewRoundService(
+		repositories.NewRepository[models.Round](config.DB),
+		repositories.NewRepository[models.RoundSchedule](config.DB),
+	)
+	if err := roundService.EnsureRounds(from); err != nil {
+		return err
+	}
+
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		// Several sets of a user may fall in the same round, they are merged
+		// before the unique index is created again
+		if err := tx.Migrator().DropIndex(&models.Set{}, "idx_sets_user_round"); err != nil {
+			return err
+		}
+		if err := tx.Exec(`
+			UPDATE sets SET round_id = rounds.id FROM rounds
+			WHERE sets.round_id IS NULL
+				AND sets.created_at >= rounds.opens_at AND sets.created_at < rounds.closes_at`).Error; err != nil {
+			return err
+		}
+		if err := dedupeSets(tx); err != nil {
+			return err
+		}
+		if err := tx.Migrator().CreateIndex(&models.Set{}, "idx_sets_user_round"); err != nil {
+			return err
+		}
+		// Likes belong to the round of their set, the ones without a set to
+		// the round they were given in
+		if err := tx.Exec(`
+			UPDATE likes SET round_id = sets.round_id FROM sets
+			WHERE likes.round_id IS NULL AND likes.set_id = sets.id`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`
+			UPDATE likes SET round_id = rounds.id FROM rounds
+			WHERE likes.round_id IS NULL
+				AND likes.created_at >= rounds.opens_at AND likes.created_at < rounds.closes_at`).Error; err != nil {
+			return err
+		}
+
+		// Weekly standings started on the last Monday in the zone of the
+		// server, they are rebuilt for each round from the likes
+		var legacy int64
+		if err := tx.Model(&models.LeaderboardStanding{}).
+			Where("period = ? AND round_id IS NULL", models.LeaderboardPeriodWeek).
+			Count(&legacy).Error; err != nil {
+			return err
+		}
+		if legacy == 0 {
+			return nil
+		}
+		if err := tx.Where("period = ? AND round_id IS NULL", models.LeaderboardPeriodWeek).
+			Delete(&models.LeaderboardStanding{}).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`
+			INSERT INTO leaderboard_standings (period, period_start, round_id, user_id, likes, updated_at)
+			SELECT ?, rounds.opens_at, rounds.id, sets.user_id, COUNT(likes.id), ?
+			FROM likes
+			JOIN sets ON sets.id = likes.set_id
+			JOIN rounds ON rounds.id = likes.round_id
+			WHERE likes.user_id <> sets.user_id
+			GROUP BY rounds.id, rounds.opens_at, sets.user_id
+			ON CONFLICT DO NOTHING`,
+			models.LeaderboardPeriodWeek, time.Now()).Error
+	})
+}
+
+// dedupeSets keeps the latest set of each user in each round. The likes of
+// the other sets move to it along with the tracks they liked, so do their
+// frozen results.
+func dedupeSets(tx *gorm.DB) error {
+	statements := []string{
+		`CREATE TEMP TABLE set_duplicates ON COMMIT DROP AS
+		SELECT id AS duplicate_id, kept_id FROM (
+			SELECT id, FIRST_VALUE(id) OVER (PARTITION BY user_id, round_id ORDER BY created_at DESC, id) AS kept_id
+			FROM sets WHERE round_id IS NOT NULL
+		) ranked WHERE id <> kept_id`,
+		`UPDATE likes SET set_id = d.kept_id FROM set_duplicates d WHERE likes.set_id = d.duplicate_id`,
+		`INSERT INTO set_tracks (set_id, track_id)
+		SELECT DISTINCT d.kept_id, st.track_id FROM set_tracks st
+		JOIN set_duplicates d ON d.duplicate_id = st.set_id
+		WHERE EXISTS (SELECT 1 FROM likes WHERE likes.set_id = d.kept_id AND likes.track_id = st.track_id)
+		ON CONFLICT DO NOTHING`,
+	}
+	// Rounds are only closed once their results tables exist
+	if tx.Migrator().HasTable(&models.RoundTrackResult{}) {
+		statements = append(statements,
+			// Results of a track liked from several duplicates add up
+			`UPDATE round_track_results k SET likes = k.likes + merged.likes FROM (
+				SELECT d.kept_id, r.round_id, r.track_id, SUM(r.likes) AS likes
+				FROM round_track_results r JOIN set_duplicates d ON d.duplicate_id = r.set_id
+				GROUP BY d.kept_id, r.round_id, r.track_id
+			) merged
+			WHERE k.set_id = merged.kept_id AND k.round_id = merged.round_id AND k.track_id = merged.track_id`,
+			`DELETE FROM round_track_results r USING set_duplicates d
+			WHERE r.set_id = d.duplicate_id AND EXISTS (
+				SELECT 1 FROM round_track_results k
+				WHERE k.set_id = d.kept_id AND k.round_id = r.round_id AND k.track_id = r.track_id
+			)`,
+			`INSERT INTO round_track_results (round_id, track_id, set_id, likes, rank, reached_at)
+			SELECT r.round_id, r.track_id, d.kept_id, SUM(r.likes), MIN(r.rank), MAX(r.reached_at)
+			FROM round_track_results r JOIN set_duplicates d ON d.duplicate_id = r.set_id
+			GROUP BY r.round_id, r.track_id, d.kept_id`,
+			`DELETE FROM round_track_results r USING set_duplicates d WHERE r.set_id = d.duplicate_id`,
+			`UPDATE round_results SET track_of_the_week_set_id = d.kept_id FROM set_duplicates d
+			WHERE round_results.track_of_the_week_set_id = d.duplicate_id`,
+		)
+	}
+	statements = append(statements,
+		`DELETE FROM set_tracks WHERE set_id IN (SELECT duplicate_id FROM set_duplicates)`,
+		`DELETE FROM sets WHERE id IN (SELECT duplicate_id FROM set_duplicates)`,
+		`DROP TABLE set_duplicates`,
+	)
+	for _, statement := range statements {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rotateKeys re-encrypts the Spotify tokens not yet sealed with the active key,
+// including the ones stored in plaintext before encryption was introduced
+func rotateKeys() {
+	activeKeyID := encryption.ActiveKeyID()
+	if activeKeyID == "" {
+		log.Fatalf("TOKEN_ENCRYPTION_KEY_ID is not set")
+	}
+
+	log.Printf("Re-encrypting Spotify tokens with key %s...", activeKeyID)
+	var rotated int
+	var tokens []models.SpotifyToken
+	// Values sealed before they were bound to their row are sealed again too
+	result := config.DB.Where("key_id IS NULL OR key_id <> ? OR access_token LIKE ? OR refresh_token LIKE ?",
+		activeKeyID, "enc:v1:%", "enc:v1:%").
+		FindInBatches(&tokens, rotateBatchSize, func(tx *gorm.DB, batch int) error {
+			for i := range tokens {
+				// Saving encrypts the tokens again with the active key
+				if err := tx.Save(&tokens[i]).Error; err != nil {
+					return err
+				}
+			}
+			rotated += len(tokens)
+			log.Printf("Re-encrypted %d tokens", rotated)
+			return nil
+		})
+	if result.Error != nil {
+		log.Fatalf("Error re-encrypting tokens: %v", result.Error)
+	}
+	log.Printf("Key rotation completed, %d tokens re-encrypted", rotated)
+}
+
+// grantAdmin gives the admin role to a user, the admin API can't grant it
+// before a first admin exists
+func grantAdmin(username string) {
+	if username == "" {
+		flag.Usage()
+		log.Fatal("Missing username")
+	}
+	result := config.DB.Model(&models.User{}).Where("username = ?", username).Update("role", models.UserRoleAdmin)
+	if result.Error != nil {
+		log.Fatalf("Error granting admin role: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		log.Fatalf("User %q not found", username)
+	}
+	log.Printf("Granted admin role to %s", username)
+}
+
+// convertDummySets copies the dummy sets into house sets, then deletes them
+// along with the dummy column
+func convertDummySets() error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		var setIDs []uuid.UUID
+		if err := tx.Raw("SELECT id FROM sets WHERE dummy ORDER BY created_at").Scan(&setIDs).Error; err != nil {
+			return err
+		}
+
+		for i, setID := range setIDs {
+			var set models.Set
+			if err := tx.Preload("Tracks").Preload("User").First(&set, "id = ?", setID).Error; err != nil {
+				return err
+			}
+			houseSet := models.HouseSet{
+				Name:          set.Name,
+				Curator:       set.User.Username,
+				ProfilePicURL: set.User.ProfilePicURL,
+				Link:          set.Link,
+				StartsAt:      set.CreatedAt,
+				DisplayOrder:  i,
+				Tracks:        set.Tracks,
+			}
+			if err := tx.Create(&houseSet).Error; err != nil {
+				return err
+			}
+			if err := tx.Select("Tracks").Delete(&set).Error; err != nil {
+				return err
+			}
+		}
+		log.Printf("Converted %d dummy sets", len(setIDs))
+
+		return tx.Migrator().DropColumn(&models.Set{}, "dummy")
+	})
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/repositories"
+	"github.com/VincentBaron/bangr/backend/internal/services"
+	"github.com/VincentBaron/bangr/backend/internal/tokenstore"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// dateLayout is the layout of the days given to backfill
+const dateLayout = "2006-01-02"
+
+// commands runs the subcommands of the cron binary, each returning the report
+// of the users it went through
+type commands struct {
+	userRepository *repositories.Repository[models.User]
+	syncService    *services.SyncService
+	roundService   *services.RoundService
+	cronRunService *services.CronRunService
+	tokenStore     *tokenstore.Store
+}
+
+func (c *commands) run(args []string) (*services.JobReport, error) {
+	switch args[0] {
+	case "sync":
+		return c.sync(args[1:])
+	case "backfill":
+		return c.backfill(args[1:])
+	case "tokens":
+		if len(args) < 2 || args[1] != "refresh" {
+			return nil, errors.New("expected tokens refresh")
+		}
+		return c.refreshTokens(args[2:])
+	}
+	return nil, fmt.Errorf("unknown command %q, expected sync, backfill or tokens refresh", args[0])
+}
+
+// sync syncs the sets of every user, or of a single one, into the current
+// round or the given one
+func (c *commands) sync(args []string) (*services.JobReport, error) {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	userFlag := fs.String("user", "", "Only sync the user with this id or username")
+	roundNumber := fs.Int("round", 0, "Sync the sets of the round with this number instead of the current one")
+	dryRun := fs.Bool("dry-run", false, "Print the changes to the sets without saving them")
+	includeClosed := fs.Bool("include-closed", false, "Sync the round even if its results are frozen")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+
+	opts := services.SyncOptions{DryRun: *dryRun, IncludeClosed: *includeClosed}
+	if *roundNumber != 0 {
+		round, err := c.roundService.GetByNumber(*roundNumber)
+		if err != nil {
+			return nil, err
+		}
+		if round.OpensAt.After(time.Now()) {
+			return nil, fmt.Errorf("round %d is not open yet", round.Number)
+		}
+		// The missing sets of a past round are created as by a backfill
+		opts.Round = round
+		opts.Late = true
+	}
+
+	return c.track("sync", *dryRun, func() (*services.JobReport, error) {
+		if *userFlag == "" {
+			return c.syncService.SyncAll(context.Background(), opts)
+		}
+		user, err := c.findUser(*userFlag)
+		if err != nil {
+			return nil, err
+		}
+		return c.syncService.SyncUsers(context.Background(), []models.User{*user}, opts)
+	})
+}
+
+// backfill creates the missing sets of the rounds opened between the days,
+// in the timezone of the schedule. The sets already saved stay frozen, and
+// the closed rounds are skipped unless included.
+func (c *commands) backfill(args []string) (*services.JobReport, error) {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	fromFlag := fs.String("from", "", "First day of the rounds to backfill, as YYYY-MM-DD")
+	toFlag := fs.String("to", "", "Last day of the rounds to backfill, as YYYY-MM-DD, today by default")
+	dryRun := fs.Bool("dry-run", false, "Print the sets that would be created without saving them")
+	includeClosed := fs.Bool("include-closed", false, "Also backfill the rounds whose results are frozen")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+
+	location := c.roundService.Location()
+	if *fromFlag == "" {
+		return nil, errors.New("--from is required")
+	}
+	from, err := time.ParseInLocation(dateLayout, *fromFlag, location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --from: %w", err)
+	}
+	now := time.Now().In(location)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+	if *toFlag != "" {
+		if to, err = time.ParseInLocation(dateLayout, *toFlag, location); err != nil {
+			return nil, fmt.Errorf("invalid --to: %w", err)
+		}
+	}
+	if to.Before(from) {
+		return nil, errors.New("--to is before --from")
+	}
+
+	return c.track("backfill", *dryRun, func() (*services.JobReport, error) {
+		// Include the rounds opening during the last day
+		rounds, err := c.roundService.Between(from, to.AddDate(0, 0, 1))
+		if err != nil {
+			return nil, err
+		}
+		if len(rounds) == 0 {
+			log.Printf("No round opened between %s and %s", from.Format(dateLayout), to.Format(dateLayout))
+		}
+
+		report := services.JobReport{}
+		for i := range rounds {
+			log.Printf("Backfilling round %d", rounds[i].Number)
+			opts := services.SyncOptions{DryRun: *dryRun, Round: &rounds[i], IncludeClosed: *includeClosed, Late: true}
+			roundReport, err := c.syncService.SyncAll(context.Background(), opts)
+			if err != nil {
+				return &report, fmt.Errorf("backfilling round %d: %w", rounds[i].Number, err)
+			}
+			report.Add(roundReport)
+		}
+		return &report, nil
+	})
+}
+
+// refreshTokens renews the Spotify token of every active user, flagging the
+// users whose grant was revoked before the next sync runs into it
+func (c *commands) refreshTokens(args []string) (*services.JobReport, error) {
+	fs := flag.NewFlagSet("tokens refresh", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+
+	return c.track("tokens-refresh", false, func() (*services.JobReport, error) {
+		users, err := c.userRepository.FindAllByFilter(map[string]interface{}{"deletion_scheduled_at": nil, "banned_at": nil})
+		if err != nil {
+			return nil, fmt.Errorf("error fetching users: %w", err)
+		}
+
+		report := services.JobReport{}
+		for i := range users {
+			if users[i].NeedsReauth {
+				report.Skipped++
+				continue
+			}
+			_, err := c.tokenStore.Refresh(context.Background(), users[i].ID)
+			switch {
+			case errors.Is(err, tokenstore.ErrNotLinked), errors.Is(err, tokenstore.ErrReauthRequired):
+				log.Printf("%s: skipped, %v", users[i].Username, err)
+				report.Skipped++
+			case err != nil:
+				log.Printf("error refreshing token of user %s: %v", users[i].ID, err)
+				report.Errored++
+			default:
+				report.Processed++
+			}
+		}
+		return &report, nil
+	})
+}
+
+// track runs the job and logs its report. The run is recorded unless it is a
+// dry run, which saves nothing, and fails when the job failed for some users.
+func (c *commands) track(job string, dryRun bool, fn func() (*services.JobReport, error)) (*services.JobReport, error) {
+	var report *services.JobReport
+	run := func() error {
+		var err error
+		report, err = fn()
+		if report != nil {
+			log.Printf("Summary of %s: %s", job, report)
+		}
+		if err != nil {
+			return err
+		}
+		return report.Err()
+	}
+
+	if dryRun {
+		err := run()
+		return report, err
+	}
+	err := c.cronRunService.Track(job, run)
+	return report, err
+}
+
+// findUser finds the user by id or username
+func (c *commands) findUser(value string) (*models.User, error) {
+	filter := map[string]interface{}{"username": value}
+	if id, err := uuid.Parse(value); err == nil {
+		filter = map[string]interface{}{"id": id}
+	}
+	user, err := c.userRepository.FindByFilter(filter)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("user %s not found", value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding user %s: %w", value, err)
+	}
+	return user, nil
+}
@@ -1,36 +1,25 @@
 package main
 
 import (
-	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
-	"strings"
+	"os"
 	"time"
 
 	"github.com/VincentBaron/bangr/backend/internal/config"
 	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/ratelimit"
 	"github.com/VincentBaron/bangr/backend/internal/repositories"
-	"github.com/google/uuid"
+	"github.com/VincentBaron/bangr/backend/internal/services"
+	"github.com/VincentBaron/bangr/backend/internal/tokenstore"
 	"github.com/robfig/cron/v3"
-	"github.com/zmb3/spotify/v2"
-	spotifyauth "github.com/zmb3/spotify/v2/auth"
-	"golang.org/x/oauth2"
 )
 
-type cronHandler struct {
-	userRepository  *repositories.Repository[models.User]
-	setRepository   *repositories.Repository[models.Set]
-	trackRepository *repositories.Repository[models.Track]
-}
-
-func NewCronHandler(userRepo *repositories.Repository[models.User], setRepo *repositories.Repository[models.Set], trackRepo *repositories.Repository[models.Track]) *cronHandler {
-	return &cronHandler{
-		userRepository:  userRepo,
-		setRepository:   setRepo,
-		trackRepository: trackRepo,
-	}
-}
+// staleRateLimitBuckets is longer than any configured limit, so the deleted
+// buckets were full again
+const staleRateLimitBuckets = 24 * time.Hour
 
 func init() {
 	// Load environment variables from .env file
@@ -45,21 +34,146 @@ func init() {
 
 func main() {
 	manualTrigger := flag.Bool("manual", false, "Manually trigger the cron job")
+	dryRun := flag.Bool("dry-run", false, "With -manual, print the changes to the sets without saving them")
 	autoSchedule := flag.String("auto", "", "Automatically trigger the cron job with the given schedule")
+	closeRounds := flag.Bool("close-rounds", false, "Freeze the results of the rounds that ended")
+	rebuildLeaderboard := flag.Bool("leaderboard", false, "Rebuild the leaderboard standings of the current periods")
+	cleanup := flag.Bool("cleanup", false, "Delete the expired OAuth states, sessions, data exports and login attempts, and purge the deleted accounts")
+	exports := flag.Bool("exports", false, "Build the pending data exports")
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage: %s [flags] [command]\n\nCommands:\n", os.Args[0])
+		fmt.Fprintln(out, "  sync [--user id|username] [--round number] [--include-closed] [--dry-run]")
+		fmt.Fprintln(out, "  backfill --from YYYY-MM-DD [--to YYYY-MM-DD] [--include-closed] [--dry-run]")
+		fmt.Fprintln(out, "  tokens refresh")
+		fmt.Fprintln(out, "\nFlags:")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
 	// Initialize repositories
 	userRepo := repositories.NewRepository[models.User](config.DB)
 	setRepo := repositories.NewRepository[models.Set](config.DB)
 	trackRepo := repositories.NewRepository[models.Track](config.DB)
+	likeRepo := repositories.NewRepository[models.Like](config.DB)
+	genreRepo := repositories.NewRepository[models.Genre](config.DB)
+	oauthStateRepo := repositories.NewRepository[models.OAuthState](config.DB)
+	sessionRepo := repositories.NewRepository[models.Session](config.DB)
+	refreshTokenRepo := repositories.NewRepository[models.RefreshToken](config.DB)
+	dataExportRepo := repositories.NewRepository[models.DataExport](config.DB)
+	auditEventRepo := repositories.NewRepository[models.AuditEvent](config.DB)
+	loginAttemptRepo := repositories.NewRepository[models.LoginAttempt](config.DB)
+	cronRunRepo := repositories.NewRepository[models.CronRun](config.DB)
+	roundRepo := repositories.NewRepository[models.Round](config.DB)
+	roundScheduleRepo := repositories.NewRepository[models.RoundSchedule](config.DB)
+
+	// Initialize services
+	userService := services.NewUserService(userRepo, genreRepo)
+	roundService := services.NewRoundService(roundRepo, roundScheduleRepo)
+	roundResultService := services.NewRoundResultService(roundService)
+	leaderboardService := services.NewLeaderboardService(trackRepo, likeRepo, roundService)
+	oauthStateService := services.NewOAuthStateService(oauthStateRepo)
+	sessionService := services.NewSessionService(sessionRepo, refreshTokenRepo)
+	tokenStore := tokenstore.New(config.DB)
+	accountService := services.NewAccountService(userRepo, sessionService, leaderboardService, tokenStore)
+	exportService := services.NewExportService(userRepo, setRepo, dataExportRepo)
+	loginGuardService := services.NewLoginGuardService(loginAttemptRepo, services.NewAuditService(auditEventRepo))
+	rateLimiter := ratelimit.NewPostgresLimiter(config.DB)
+
+	syncService := services.NewSyncService(userRepo, setRepo, trackRepo, userService, roundService, leaderboardService, tokenStore)
+	cronRunService := services.NewCronRunService(cronRunRepo)
+	cmds := &commands{
+		userRepository: userRepo,
+		syncService:    syncService,
+		roundService:   roundService,
+		cronRunService: cronRunService,
+		tokenStore:     tokenStore,
+	}
+
+	// Commands end with the report of the users they went through, and exit
+	// with an error when they failed for any of them
+	if flag.NArg() > 0 {
+		if _, err := cmds.run(flag.Args()); err != nil {
+			log.Fatalf("Error running %s: %v", flag.Arg(0), err)
+		}
+		return
+	}
+
+	// Expired rows deleted by the cleanup job, each returning how many it deleted
+	cleanupTasks := []cleanupTask{
+		{"expired OAuth states", oauthStateService.DeleteExpired},
+		{"expired sessions", sessionService.DeleteExpired},
+		{"deleted accounts", accountService.PurgeDeleted},
+		{"expired data exports", exportService.DeleteExpired},
+		{"expired login attempts", loginGuardService.DeleteExpired},
+		{"stale rate limit buckets", func() (int64, error) { return rateLimiter.DeleteStale(staleRateLimitBuckets) }},
+	}
+
+	// Every job records its runs, listed in the admin API
+	syncSets := func() error {
+		_, err := cmds.sync(nil)
+		return err
+	}
+	rebuildStandings := func() error {
+		return cronRunService.Track("leaderboard", leaderboardService.RebuildStandings)
+	}
+	generateRounds := func() error {
+		return cronRunService.Track("rounds", func() error { return roundService.EnsureRounds(time.Now()) })
+	}
+	closeEndedRounds := func() error {
+		return cronRunService.Track("close-rounds", func() error {
+			closed, err := roundResultService.CloseDue()
+			log.Printf("Closed %d rounds", closed)
+			return err
+		})
+	}
+	cleanUp := func() error {
+		return cronRunService.Track("cleanup", func() error { return runCleanup(cleanupTasks) })
+	}
+	buildExports := func() error {
+		return cronRunService.Track("exports", func() error {
+			processed, err := exportService.ProcessPending()
+			log.Printf("Built %d data exports", processed)
+			return err
+		})
+	}
+
+	if *rebuildLeaderboard {
+		if err := rebuildStandings(); err != nil {
+			log.Fatalf("Error rebuilding leaderboard standings: %v", err)
+		}
+		log.Println("Leaderboard standings rebuilt")
+		return
+	}
+
+	if *closeRounds {
+		if err := closeEndedRounds(); err != nil {
+			log.Fatalf("Error closing rounds: %v", err)
+		}
+		return
+	}
+
+	if *cleanup {
+		if err := cleanUp(); err != nil {
+			log.Fatalf("Error cleaning up: %v", err)
+		}
+		return
+	}
 
-	// Initialize cron handler
-	cronHandler := NewCronHandler(userRepo, setRepo, trackRepo)
+	if *exports {
+		if err := buildExports(); err != nil {
+			log.Fatalf("Error building data exports: %v", err)
+		}
+		return
+	}
 
 	if *manualTrigger {
-		err := cronHandler.syncSpotifySets()
-		if err != nil {
-			log.Printf("Error syncing Spotify sets: %v", err)
+		args := []string{}
+		if *dryRun {
+			args = append(args, "--dry-run")
+		}
+		if _, err := cmds.sync(args); err != nil {
+			log.Fatalf("Error syncing Spotify sets: %v", err)
 		}
 		return
 	}
@@ -67,14 +181,41 @@ func main() {
 	fmt.Println(*autoSchedule)
 
 	if *autoSchedule != "" {
-		c := cron.New(cron.WithLocation(time.FixedZone("UTC+1", 1*60*60)))
+		// Schedules follow the timezone of the rounds
+		c := cron.New(cron.WithLocation(roundService.Location()))
 		c.AddFunc(*autoSchedule, func() {
 			fmt.Println("Running cron job")
-			err := cronHandler.syncSpotifySets()
-			if err != nil {
+			if err := syncSets(); err != nil {
 				log.Printf("Error syncing Spotify sets: %v", err)
 			}
 		})
+		// Fix any drift of the standings updated on each like
+		c.AddFunc("@hourly", func() {
+			if err := rebuildStandings(); err != nil {
+				log.Printf("Error rebuilding leaderboard standings: %v", err)
+			}
+		})
+		c.AddFunc("@hourly", func() {
+			if err := generateRounds(); err != nil {
+				log.Printf("Error generating rounds: %v", err)
+			}
+		})
+		// Rounds close on the hour in the timezone of the schedule
+		c.AddFunc("@hourly", func() {
+			if err := closeEndedRounds(); err != nil {
+				log.Printf("Error closing rounds: %v", err)
+			}
+		})
+		c.AddFunc("@hourly", func() {
+			if err := cleanUp(); err != nil {
+				log.Printf("Error cleaning up: %v", err)
+			}
+		})
+		c.AddFunc("@every 5m", func() {
+			if err := buildExports(); err != nil {
+				log.Printf("Error building data exports: %v", err)
+			}
+		})
 		c.Start()
 
 		// Keep the program running
@@ -84,141 +225,21 @@ func main() {
 	}
 }
 
-func (h *cronHandler) syncSpotifySets() error {
-	users, err := h.userRepository.FindAllByFilter(map[string]interface{}{}, "SpotifyToken")
-	if err != nil {
-		return fmt.Errorf("error fetching users: %w", err)
-	}
-	existingTracks, err := h.trackRepository.FindAllByFilter(map[string]interface{}{})
-	if err != nil {
-		return fmt.Errorf("error fetching existing tracks: %w", err)
-	}
-	existingTracksURIMap := make(map[string]models.Track)
-	for _, track := range existingTracks {
-		existingTracksURIMap[track.URI] = track
-	}
-
-	for _, user := range users {
-		spotifyClient, err := h.initSpotifyClient(user)
-		if err != nil {
-			log.Printf("error initializing Spotify client for user %s: %v", user.ID, err)
-			continue
-		}
-		playlist, err := spotifyClient.GetPlaylist(context.Background(), spotify.ID(user.SpotifyPlaylistLink))
-		if err != nil {
-			log.Printf("error fetching playlist %s: %v", user.SpotifyPlaylistLink, err)
-			continue
-		}
-		set := models.Set{
-			ID:     uuid.New(),
-			Name:   playlist.Name,
-			Link:   playlist.ExternalURLs["spotify"],
-			UserID: user.ID,
-		}
-		err = h.setRepository.Save(&set)
-		if err != nil {
-			log.Printf("error saving set %s: %v", set.ID, err)
-			continue
-		}
-
-		playlistItems, err := spotifyClient.GetPlaylistItems(context.Background(), spotify.ID(user.SpotifyPlaylistLink))
-		if err != nil {
-			log.Printf("error fetching tracks for playlist %s: %v", playlist.ID, err)
-			continue
-		}
-
-		for i, item := range playlistItems.Items {
-			if i >= 3 {
-				break
-			}
-			trackURI := string(item.Track.Track.URI)
-			track, exists := existingTracksURIMap[trackURI]
-			if exists {
-				// Track already exists, associate it with the new set
-				err = config.DB.Model(&track).Association("Sets").Append(&set)
-				if err != nil {
-					log.Printf("error associating track %s with set %s: %v", track.URI, set.ID, err)
-					continue
-				}
-			} else {
-				// Track does not exist, create a new track and associate it with the set
-				artistNames := make([]string, 0, len(item.Track.Track.Artists))
-				for _, artist := range item.Track.Track.Artists {
-					artistNames = append(artistNames, artist.Name)
-				}
-				track = models.Track{
-					ID:     uuid.New(),
-					Name:   item.Track.Track.Name,
-					Artist: strings.Join(artistNames, ", "),
-					URI:    trackURI,
-					ImgURL: item.Track.Track.Album.Images[0].URL,
-				}
-				err = h.trackRepository.Save(&track)
-				if err != nil {
-					log.Printf("error saving track %s: %v", track.URI, err)
-					continue
-				}
-				// Now associate the new track with the set
-				err = config.DB.Model(&track).Association("Sets").Append(&set)
-				if err != nil {
-					log.Printf("error associating track %s with set %s: %v", track.URI, set.ID, err)
-					continue
-				}
-				existingTracksURIMap[track.URI] = track
-			}
-		}
-	}
-	return nil
+type cleanupTask struct {
+	name string
+	run  func() (int64, error)
 }
 
-func (h *cronHandler) initSpotifyClient(user models.User) (*spotify.Client, error) {
-	spotifyToken := oauth2.Token{
-		AccessToken:  user.SpotifyToken.AccessToken,
-		TokenType:    "Bearer",
-		RefreshToken: user.SpotifyToken.RefreshToken,
-		Expiry:       user.SpotifyToken.Expiry,
-	}
-	ctx := context.Background()
-	httpClient := spotifyauth.New().Client(ctx, &spotifyToken)
-	client := spotify.New(httpClient)
-	oauthConf := &oauth2.Config{
-		ClientID:     config.Conf.SpotifyClientID,
-		ClientSecret: config.Conf.SpotifyClientSecret,
-		Endpoint: oauth2.Endpoint{
-			TokenURL: spotifyauth.TokenURL,
-		},
-	}
-	if spotifyToken.Expiry.Before(time.Now()) {
-		src := oauthConf.TokenSource(ctx, &spotifyToken)
-		token, err := src.Token()
+// runCleanup runs every task even when one fails, returning their errors joined
+func runCleanup(tasks []cleanupTask) error {
+	var errs []error
+	for _, task := range tasks {
+		deleted, err := task.run()
 		if err != nil {
-			fmt.Printf("Couldn't refresh token: %v\n", err)
-			return nil, err
-		}
-
-		newSpotifyToken := models.SpotifyToken{
-			AccessToken:  token.AccessToken,
-			RefreshToken: token.RefreshToken,
-			Expiry:       token.Expiry,
-		}
-		user.SpotifyToken = newSpotifyToken
-
-		// Begin a transaction
-		tx := config.DB.Begin()
-
-		if err := tx.Model(&user).Association("SpotifyToken").Replace(&newSpotifyToken); err != nil {
-			tx.Rollback()
-			return nil, err
-		}
-		tx.Model(&user).Save(&user)
-
-		// Commit the transaction
-		if err := tx.Commit().Error; err != nil {
-			return nil, err
+			errs = append(errs, fmt.Errorf("cleaning up %s: %w", task.name, err))
+			continue
 		}
-
-		httpClient = spotifyauth.New().Client(ctx, token)
-		client = spotify.New(httpClient)
+		log.Printf("Deleted %d %s", deleted, task.name)
 	}
-	return client, nil
+	return errors.Join(errs...)
 }
@@ -1,9 +1,11 @@
 package config
 
 import (
-	"fmt"
+	"log"
 	"os"
+	"strings"
 
+	"github.com/VincentBaron/bangr/backend/internal/encryption"
 	"github.com/VincentBaron/bangr/backend/internal/models"
 	"github.com/joho/godotenv"
 	"gopkg.in/yaml.v2"
@@ -16,7 +18,7 @@ func LoadEnvVariables() {
 	if err != nil {
 		err := godotenv.Load()
 		if err != nil {
-			fmt.Errorf("Error loading .env file")
+			log.Println("Error loading .env file")
 		}
 		Conf.YoutubeAPIKey = os.Getenv("YOUTUBE_API_KEY")
 		Conf.SpotifyClientID = os.Getenv("SPOTIFY_CLIENT_ID")
@@ -24,6 +26,12 @@ func LoadEnvVariables() {
 		Conf.SpotifyRedirectURL = os.Getenv("SPOTIFY_REDIRECT_URL")
 		Conf.SpotifyScopes = os.Getenv("SPOTIFY_SCOPES")
 		Conf.BuyMeACoffeeAPIKey = os.Getenv("BUYMEACOFFEE_API_KEY")
+		Conf.TokenEncryptionKeys = os.Getenv("TOKEN_ENCRYPTION_KEYS")
+		Conf.TokenEncryptionKeyID = os.Getenv("TOKEN_ENCRYPTION_KEY_ID")
+		Conf.RateLimitBackend = os.Getenv("RATE_LIMIT_BACKEND")
+		Conf.RateLimits = parseRateLimits(os.Getenv("RATE_LIMITS"))
+		Conf.TrustedProxies = parseList(os.Getenv("TRUSTED_PROXIES"))
+		Conf.TrustedPlatform = os.Getenv("TRUSTED_PLATFORM")
 	} else {
 		// Unmarshal the configsFile data into a Config struct
 		err = yaml.Unmarshal(configsFile, &Conf)
@@ -31,4 +39,23 @@ func LoadEnvVariables() {
 			// handle error
 		}
 	}
+
+	// Load the keys the Spotify tokens are encrypted with
+	if err := encryption.LoadKeys(Conf.TokenEncryptionKeys, Conf.TokenEncryptionKeyID); err != nil {
+		log.Fatalf("Error loading token encryption keys: %v", err)
+	}
+	if Conf.TokenEncryptionKeys == "" {
+		log.Fatalf("No token encryption keys configured, set TOKEN_ENCRYPTION_KEYS")
+	}
+}
+
+// parseList reads a comma separated list, ignoring the empty items
+func parseList(s string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"log"
+	"strings"
+
+	"github.com/VincentBaron/bangr/backend/internal/ratelimit"
+	"gorm.io/gorm"
+)
+
+// NewRateLimiter returns the limiter of the configured backend
+func NewRateLimiter(db *gorm.DB) ratelimit.Limiter {
+	if Conf.RateLimitBackend == "postgres" {
+		return ratelimit.NewPostgresLimiter(db)
+	}
+	return ratelimit.NewMemoryLimiter()
+}
+
+// RateLimit returns the limit configured for key, such as login.ip, or def
+func RateLimit(key string, def ratelimit.Limit) ratelimit.Limit {
+	spec, ok := Conf.RateLimits[key]
+	if !ok {
+		return def
+	}
+	limit, err := ratelimit.ParseLimit(spec)
+	if err != nil {
+		log.Printf("Ignoring rate limit %s: %v", key, err)
+		return def
+	}
+	return limit
+}
+
+// parseRateLimits reads comma separated key=limit pairs,
+// e.g. login.ip=10/1m,login.username=5/1m
+func parseRateLimits(s string) map[string]string {
+	limits := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, limit, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok {
+			limits[key] = limit
+		}
+	}
+	return limits
+}
@@ -11,7 +11,7 @@ func SyncDatabase() {
 	env := os.Getenv("ENVIRONMENT")
 	if env == "development" {
 		log.Println("Running database migrations in development mode...")
-		err := DB.AutoMigrate(&models.User{}, &models.Set{}, &models.SpotifyToken{}, &models.Track{}, &models.Like{}, &models.Genre{})
+		err := DB.AutoMigrate(&models.User{}, &models.Set{}, &models.SpotifyToken{}, &models.Track{}, &models.Like{}, &models.Genre{}, &models.LeaderboardStanding{}, &models.OAuthState{}, &models.LoginCode{}, &models.Session{}, &models.RefreshToken{}, &models.DataExport{}, &models.AuditEvent{}, &models.LoginAttempt{}, &models.RateLimitBucket{}, &models.CronRun{}, &models.HouseSet{}, &models.Round{}, &models.RoundSchedule{}, &models.RoundResult{}, &models.RoundTrackResult{}, &models.RoundCuratorResult{}, &models.SyncIssue{})
 		if err != nil {
 			log.Printf("Error during migration: %v", err)
 		}
@@ -0,0 +1,30 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+type GetAdminUserResp struct {
+	ID                  uuid.UUID       `json:"id"`
+	Username            string          `json:"username"`
+	Role                models.UserRole `json:"role"`
+	Tier                models.UserTier `json:"tier"`
+	CreatedAt           time.Time       `json:"created_at"`
+	SpotifyLinked       bool            `json:"spotify_linked"`
+	NeedsReauth         bool            `json:"needs_reauth"`
+	BannedAt            *time.Time      `json:"banned_at"`
+	BanReason           string          `json:"ban_reason,omitempty"`
+	DeletionScheduledAt *time.Time      `json:"deletion_scheduled_at"`
+}
+
+type GetAdminUsersResp struct {
+	Users []GetAdminUserResp `json:"users"`
+	Total int64              `json:"total"`
+}
+
+type PostBanReq struct {
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,16 @@
+package dto
+
+// Error codes the frontend can act on, sent along the error message
+const (
+	ErrorCodePremiumRequired       = "premium_required"
+	ErrorCodeSpotifyNotLinked      = "spotify_not_linked"
+	ErrorCodeSpotifyReauthRequired = "spotify_reauth_required"
+	ErrorCodeRateLimited           = "rate_limited"
+	ErrorCodeBanned                = "banned"
+	ErrorCodeDeletionScheduled     = "deletion_scheduled"
+)
+
+type ErrorResp struct {
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
+}
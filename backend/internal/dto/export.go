@@ -0,0 +1,66 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+type GetDataExportResp struct {
+	ID          uuid.UUID               `json:"id"`
+	Status      models.DataExportStatus `json:"status"`
+	CreatedAt   time.Time               `json:"created_at"`
+	CompletedAt *time.Time              `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time              `json:"expires_at,omitempty"`
+}
+
+// UserExport is the personal data of a user, written as data.json in the archive
+type UserExport struct {
+	ExportedAt    time.Time                `json:"exported_at"`
+	Profile       ExportProfile            `json:"profile"`
+	Genres        []models.GenreName       `json:"genres"`
+	Sets          []ExportSet              `json:"sets"`
+	LikesGiven    []ExportLike             `json:"likes_given"`
+	LikesReceived []ExportLike             `json:"likes_received"`
+	Leaderboard   []ExportLeaderboardEntry `json:"leaderboard"`
+}
+
+type ExportProfile struct {
+	ID                  uuid.UUID       `json:"id"`
+	Username            string          `json:"username"`
+	CreatedAt           time.Time       `json:"created_at"`
+	ProfilePicURL       string          `json:"profile_pic_url"`
+	SpotifyUserID       string          `json:"spotify_user_id"`
+	SpotifyPlaylistLink string          `json:"spotify_playlist_link"`
+	Tier                models.UserTier `json:"tier"`
+	HasPaid             bool            `json:"has_paid"`
+}
+
+type ExportSet struct {
+	ID        uuid.UUID     `json:"id"`
+	Name      string        `json:"name"`
+	Link      string        `json:"link"`
+	CreatedAt time.Time     `json:"created_at"`
+	Tracks    []ExportTrack `json:"tracks"`
+}
+
+type ExportTrack struct {
+	ID     uuid.UUID `json:"id"`
+	Name   string    `json:"name"`
+	Artist string    `json:"artist"`
+	URI    string    `json:"uri"`
+}
+
+type ExportLike struct {
+	ID        uuid.UUID   `json:"id"`
+	CreatedAt time.Time   `json:"created_at"`
+	SetID     *uuid.UUID  `json:"set_id"`
+	Track     ExportTrack `json:"track"`
+}
+
+type ExportLeaderboardEntry struct {
+	Period      models.LeaderboardPeriod `json:"period"`
+	PeriodStart time.Time                `json:"period_start"`
+	Likes       int                      `json:"likes"`
+}
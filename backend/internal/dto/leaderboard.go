@@ -7,6 +7,18 @@ type LeaderboardEntry struct {
 	Username      string    `json:"username"`
 	ProfilePicURL string    `json:"profile_pic_url"`
 	Likes         int       `json:"likes"`
+	Rank          int       `json:"rank"`
+}
+
+type LeaderboardPage struct {
+	Entries    []LeaderboardEntry `json:"entries"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+type LeaderboardMeResp struct {
+	Rank       int                `json:"rank"`
+	Likes      int                `json:"likes"`
+	Neighbours []LeaderboardEntry `json:"neighbours"`
 }
 
 type UpdateLeaderboardReq struct {
@@ -0,0 +1,78 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+type GetRoundResp struct {
+	ID                 uuid.UUID           `json:"id"`
+	Number             int                 `json:"number"`
+	OpensAt            time.Time           `json:"opens_at"`
+	SubmissionDeadline time.Time           `json:"submission_deadline"`
+	VotingStartsAt     time.Time           `json:"voting_starts_at"`
+	ClosesAt           time.Time           `json:"closes_at"`
+	Status             models.RoundStatus  `json:"status"`
+	SetSize            int                 `json:"set_size"`
+	SetSelection       models.SetSelection `json:"set_selection"`
+	// ClosedAt is set once the results of the round are available
+	ClosedAt *time.Time `json:"closed_at"`
+}
+
+type GetRoundsResp struct {
+	Rounds []GetRoundResp `json:"rounds"`
+	Total  int64          `json:"total"`
+}
+
+type PutRoundScheduleReq struct {
+	Weekday         time.Weekday `json:"weekday"`
+	Hour            int          `json:"hour"`
+	Timezone        string       `json:"timezone" binding:"required"`
+	LengthDays      int          `json:"length_days" binding:"required"`
+	SubmissionHours int          `json:"submission_hours"`
+	// SetSize and SetSelection default to 3 tracks added last when omitted
+	SetSize      int                 `json:"set_size"`
+	SetSelection models.SetSelection `json:"set_selection"`
+}
+
+// PatchRoundReq moves the deadline or the start of the voting of a single
+// round, or changes how its sets are picked
+type PatchRoundReq struct {
+	SubmissionDeadline *time.Time           `json:"submission_deadline"`
+	VotingStartsAt     *time.Time           `json:"voting_starts_at"`
+	SetSize            *int                 `json:"set_size"`
+	SetSelection       *models.SetSelection `json:"set_selection"`
+}
+
+type RoundTrackEntry struct {
+	Rank       int       `json:"rank"`
+	Likes      int       `json:"likes"`
+	TrackID    uuid.UUID `json:"track_id"`
+	URI        string    `json:"uri"`
+	Name       string    `json:"name"`
+	Artist     string    `json:"artist"`
+	ImgURL     string    `json:"img_url"`
+	PreviewURL string    `json:"preview_url"`
+	// SetID, Username and ProfilePicURL are the set the track was liked from and its curator
+	SetID         uuid.UUID `json:"set_id"`
+	Username      string    `json:"username"`
+	ProfilePicURL string    `json:"profile_pic_url"`
+}
+
+type RoundCuratorEntry struct {
+	Rank          int       `json:"rank"`
+	Likes         int       `json:"likes"`
+	UserID        uuid.UUID `json:"user_id"`
+	Username      string    `json:"username"`
+	ProfilePicURL string    `json:"profile_pic_url"`
+}
+
+type GetRoundResultsResp struct {
+	Round          GetRoundResp        `json:"round"`
+	TrackOfTheWeek *RoundTrackEntry    `json:"track_of_the_week"`
+	TopCurator     *RoundCuratorEntry  `json:"top_curator"`
+	Tracks         []RoundTrackEntry   `json:"tracks"`
+	Curators       []RoundCuratorEntry `json:"curators"`
+}
@@ -1,6 +1,9 @@
 package dto
 
 import (
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/models"
 	"github.com/google/uuid"
 )
 
@@ -10,6 +13,27 @@ type GetSetResp struct {
 	Tracks        []GetTrackResp `json:"tracks"`
 	Username      string         `json:"username"`
 	ProfilePicURL string         `json:"profilePicURL"`
+	// House is set for the sets curated by the admins
+	House bool `json:"house"`
+	// RoundID is the round the set was submitted to, house sets have none
+	RoundID *uuid.UUID `json:"round_id,omitempty"`
+}
+
+// PostSubmissionReq replaces the tracks of the set of the user for the current round
+type PostSubmissionReq struct {
+	// TrackURIs are Spotify track URIs, such as spotify:track:<id>
+	TrackURIs []string `json:"track_uris" binding:"required,min=1"`
+}
+
+type GetSubmissionResp struct {
+	Set GetSetResp `json:"set"`
+	// PlaylistMirrored is false when the user has no Bangr playlist to update
+	PlaylistMirrored bool `json:"playlist_mirrored"`
+}
+
+type GetSetsResp struct {
+	Sets  []GetSetResp `json:"sets"`
+	Total int64        `json:"total"`
 }
 
 type GetTrackResp struct {
@@ -20,4 +44,67 @@ type GetTrackResp struct {
 	Liked  bool      `json:"liked"`
 	Likes  int       `json:"likes"`
 	ImgURL string    `json:"img_url"`
+	// PreviewURL is empty when Spotify has no preview for the track
+	PreviewURL string `json:"preview_url"`
+}
+
+// GetTrackDetailsResp is a track with its likes in every round it appeared in
+type GetTrackDetailsResp struct {
+	ID         uuid.UUID `json:"id"`
+	URI        string    `json:"uri"`
+	Name       string    `json:"name"`
+	Artist     string    `json:"artist"`
+	ImgURL     string    `json:"img_url"`
+	PreviewURL string    `json:"preview_url"`
+	// Likes is the total over the rounds
+	Likes  int               `json:"likes"`
+	Rounds []TrackRoundEntry `json:"rounds"`
+}
+
+type TrackRoundEntry struct {
+	Round GetRoundResp `json:"round"`
+	Likes int          `json:"likes"`
+	Liked bool         `json:"liked"`
+}
+
+type TrackLikeEntry struct {
+	UserID        uuid.UUID  `json:"user_id"`
+	Username      string     `json:"username"`
+	ProfilePicURL string     `json:"profile_pic_url"`
+	RoundID       *uuid.UUID `json:"round_id"`
+	LikedAt       time.Time  `json:"liked_at"`
+}
+
+type GetTrackLikesResp struct {
+	Likes []TrackLikeEntry `json:"likes"`
+	Total int64            `json:"total"`
+	// Hidden is the number of likes of users who don't show them, not listed
+	Hidden int64 `json:"hidden"`
+}
+
+type PostHouseSetReq struct {
+	Name          string             `json:"name" binding:"required"`
+	Curator       string             `json:"curator"`
+	ProfilePicURL string             `json:"profile_pic_url"`
+	Link          string             `json:"link"`
+	StartsAt      time.Time          `json:"starts_at" binding:"required"`
+	EndsAt        *time.Time         `json:"ends_at"`
+	DisplayOrder  int                `json:"display_order"`
+	Genres        []models.GenreName `json:"genres"`
+	// TrackURIs are Spotify track URIs, such as spotify:track:<id>
+	TrackURIs []string `json:"track_uris" binding:"required,min=1"`
+}
+
+// PatchHouseSetReq updates the fields set, ClearEndsAt shows the house set until removed
+type PatchHouseSetReq struct {
+	Name          *string             `json:"name"`
+	Curator       *string             `json:"curator"`
+	ProfilePicURL *string             `json:"profile_pic_url"`
+	Link          *string             `json:"link"`
+	StartsAt      *time.Time          `json:"starts_at"`
+	EndsAt        *time.Time          `json:"ends_at"`
+	ClearEndsAt   bool                `json:"clear_ends_at"`
+	DisplayOrder  *int                `json:"display_order"`
+	Genres        *[]models.GenreName `json:"genres"`
+	TrackURIs     *[]string           `json:"track_uris"`
 }
@@ -0,0 +1,9 @@
+package dto
+
+import "time"
+
+type GetSpotifyTokenResp struct {
+	AccessToken string    `json:"access_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	ExpiresIn   int       `json:"expires_in"`
+}
@@ -1,6 +1,8 @@
 package dto
 
 import (
+	"time"
+
 	"github.com/VincentBaron/bangr/backend/internal/models"
 	"github.com/google/uuid"
 )
@@ -16,9 +18,24 @@ type GetUSerResp struct {
 	Username      string             `json:"username"`
 	Genres        []models.GenreName `json:"genres"`
 	ProfilePicURL string             `json:"profile_pic_url"`
+	SpotifyLinked bool               `json:"spotify_linked"`
+	HasPassword   bool               `json:"has_password"`
+	Tier          models.UserTier    `json:"tier"`
+	// SpotifyReauthRequired asks the user to relink Spotify after a revoked grant
+	SpotifyReauthRequired bool `json:"spotify_reauth_required"`
+	// DeletionScheduledAt is set while the account can still be restored
+	DeletionScheduledAt *time.Time      `json:"deletion_scheduled_at,omitempty"`
+	Role                models.UserRole `json:"role"`
+	ShowLikes           bool            `json:"show_likes"`
+}
+
+type DeleteMeResp struct {
+	DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
 }
 
 type PatchUserReq struct {
 	Username string             `json:"username"`
 	Genres   []models.GenreName `json:"genres"`
+	// ShowLikes is left unchanged when omitted
+	ShowLikes *bool `json:"show_likes"`
 }
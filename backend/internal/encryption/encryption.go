@@ -0,0 +1,206 @@
+// Package encryption seals secrets stored in the database with envelope
+// encryption: every value is encrypted with its own data key, itself
+// encrypted with a master key identified by a key ID.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	// prefix marks the values sealed by this package, the other ones are legacy plaintext
+	prefix = "enc:v2:"
+	// legacyPrefix marks the values sealed before they were bound to their row,
+	// they are opened with the aad of their column only
+	legacyPrefix = "enc:v1:"
+)
+
+var (
+	ErrNoKey      = errors.New("no encryption key configured")
+	ErrUnknownKey = errors.New("unknown encryption key")
+	ErrMalformed  = errors.New("malformed encrypted value")
+)
+
+var keyring = struct {
+	sync.RWMutex
+	keys     map[string][]byte
+	activeID string
+}{keys: make(map[string][]byte)}
+
+// LoadKeys configures the master keys, given as comma separated "id:base64key"
+// pairs of 32 bytes keys. New values are sealed with the key activeID, the
+// other ones are only used to open values sealed before a rotation.
+func LoadKeys(keys string, activeID string) error {
+	parsed := make(map[string][]byte)
+	for _, pair := range strings.Split(keys, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, encoded, found := strings.Cut(pair, ":")
+		if !found || id == "" {
+			return fmt.Errorf("invalid key %q, expected id:base64key", pair)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("invalid key %s: %w", id, err)
+		}
+		if len(key) != 32 {
+			return fmt.Errorf("invalid key %s: expected 32 bytes, got %d", id, len(key))
+		}
+		parsed[id] = key
+	}
+	if _, ok := parsed[activeID]; !ok && len(parsed) > 0 {
+		return fmt.Errorf("active key %q is not configured", activeID)
+	}
+
+	keyring.Lock()
+	defer keyring.Unlock()
+	keyring.keys = parsed
+	keyring.activeID = activeID
+	return nil
+}
+
+// ActiveKeyID returns the ID of the key new values are sealed with
+func ActiveKeyID() string {
+	keyring.RLock()
+	defer keyring.RUnlock()
+	return keyring.activeID
+}
+
+// KeyID returns the ID of the key the value was sealed with, empty for plaintext
+func KeyID(value string) string {
+	body, ok := envelope(value)
+	if !ok {
+		return ""
+	}
+	id, _, _ := strings.Cut(body, ":")
+	return id
+}
+
+// Legacy reports whether the value was sealed before values were bound to
+// their row, Decrypt expects the aad of its column for it
+func Legacy(value string) bool {
+	return strings.HasPrefix(value, legacyPrefix)
+}
+
+// envelope strips the prefix of a sealed value
+func envelope(value string) (string, bool) {
+	if body, ok := strings.CutPrefix(value, prefix); ok {
+		return body, true
+	}
+	return strings.CutPrefix(value, legacyPrefix)
+}
+
+// Encrypt seals plaintext with a fresh data key wrapped by the active key.
+// aad binds the value to its context, it must be given again to Decrypt.
+func Encrypt(plaintext string, aad string) (string, error) {
+	keyring.RLock()
+	keyID := keyring.activeID
+	masterKey, ok := keyring.keys[keyID]
+	keyring.RUnlock()
+	if !ok {
+		return "", ErrNoKey
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	wrappedKey, err := seal(masterKey, dataKey, []byte(keyID))
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(dataKey, []byte(plaintext), []byte(aad))
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + keyID + ":" +
+		base64.RawStdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt opens a value sealed by Encrypt, plaintext values are returned as is
+// so that rows written before encryption keep working until re-encrypted.
+func Decrypt(value string, aad string) (string, error) {
+	body, ok := envelope(value)
+	if !ok {
+		return value, nil
+	}
+
+	parts := strings.Split(body, ":")
+	if len(parts) != 3 {
+		return "", ErrMalformed
+	}
+	keyID := parts[0]
+	wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	keyring.RLock()
+	masterKey, ok := keyring.keys[keyID]
+	keyring.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+
+	dataKey, err := open(masterKey, wrappedKey, []byte(keyID))
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataKey, ciphertext, []byte(aad))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// seal encrypts with AES-GCM and prepends the nonce to the ciphertext
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(key, sealed, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
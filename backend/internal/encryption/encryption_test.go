@@ -0,0 +1,169 @@
+package encryption
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm/schema"
+)
+
+func testKey(b byte) string {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = b
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func loadKeys(t *testing.T, keys string, activeID string) {
+	t.Helper()
+	if err := LoadKeys(keys, activeID); err != nil {
+		t.Fatalf("loading keys: %v", err)
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	loadKeys(t, "k1:"+testKey(1), "k1")
+
+	sealed, err := Encrypt("secret", "access_token:1")
+	if err != nil {
+		t.Fatalf("encrypting: %v", err)
+	}
+	if !strings.HasPrefix(sealed, prefix) || KeyID(sealed) != "k1" || Legacy(sealed) {
+		t.Fatalf("got sealed value %q, want a %s value sealed with k1", sealed, prefix)
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		aad     string
+		want    string
+		wantErr bool
+	}{
+		{"same aad", sealed, "access_token:1", "secret", false},
+		{"other aad", sealed, "access_token:2", "", true},
+		{"plaintext", "legacy-plaintext", "access_token:1", "legacy-plaintext", false},
+		{"malformed", prefix + "k1:abc", "access_token:1", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decrypt(tt.value, tt.aad)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncryptWithoutKey(t *testing.T) {
+	loadKeys(t, "", "")
+	if _, err := Encrypt("secret", "access_token"); !errors.Is(err, ErrNoKey) {
+		t.Fatalf("got error %v, want %v", err, ErrNoKey)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	loadKeys(t, "k1:"+testKey(1), "k1")
+	old, err := Encrypt("secret", "refresh_token:1")
+	if err != nil {
+		t.Fatalf("encrypting: %v", err)
+	}
+
+	// The old key stays configured to open the values sealed before the rotation
+	loadKeys(t, "k1:"+testKey(1)+",k2:"+testKey(2), "k2")
+	if got, err := Decrypt(old, "refresh_token:1"); err != nil || got != "secret" {
+		t.Fatalf("got %q, %v, want the value sealed with the old key", got, err)
+	}
+	rotated, err := Encrypt("secret", "refresh_token:1")
+	if err != nil {
+		t.Fatalf("encrypting: %v", err)
+	}
+	if KeyID(rotated) != "k2" {
+		t.Errorf("got key %q, want k2", KeyID(rotated))
+	}
+
+	// Once dropped, the old key can't open its values anymore
+	loadKeys(t, "k2:"+testKey(2), "k2")
+	if _, err := Decrypt(old, "refresh_token:1"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("got error %v, want %v", err, ErrUnknownKey)
+	}
+}
+
+func TestLoadKeysInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     string
+		activeID string
+	}{
+		{"missing id", ":" + testKey(1), ""},
+		{"not base64", "k1:not-base64!", "k1"},
+		{"short key", "k1:" + base64.StdEncoding.EncodeToString([]byte("short")), "k1"},
+		{"unknown active key", "k1:" + testKey(1), "k2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := LoadKeys(tt.keys, tt.activeID); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+type token struct {
+	UserID      uuid.UUID
+	AccessToken string `gorm:"serializer:encrypted"`
+}
+
+func TestSerializerBindsRow(t *testing.T) {
+	loadKeys(t, "k1:"+testKey(1), "k1")
+	s, err := schema.Parse(&token{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatalf("parsing schema: %v", err)
+	}
+	field := s.LookUpField("access_token")
+	ctx := context.Background()
+
+	owner := token{UserID: uuid.New(), AccessToken: "secret"}
+	sealed, err := Serializer{}.Value(ctx, field, reflect.ValueOf(&owner).Elem(), owner.AccessToken)
+	if err != nil {
+		t.Fatalf("encrypting: %v", err)
+	}
+
+	legacy, err := Encrypt("secret", "access_token")
+	if err != nil {
+		t.Fatalf("encrypting: %v", err)
+	}
+	legacy = legacyPrefix + strings.TrimPrefix(legacy, prefix)
+
+	tests := []struct {
+		name    string
+		userID  uuid.UUID
+		value   interface{}
+		wantErr bool
+	}{
+		{"same row", owner.UserID, sealed, false},
+		{"copied to another user", uuid.New(), sealed, true},
+		{"legacy value", uuid.New(), legacy, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := token{UserID: tt.userID}
+			err := Serializer{}.Scan(ctx, field, reflect.ValueOf(&dst).Elem(), tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && dst.AccessToken != "secret" {
+				t.Errorf("got %q, want the decrypted token", dst.AccessToken)
+			}
+		})
+	}
+}
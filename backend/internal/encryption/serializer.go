@@ -0,0 +1,85 @@
+package encryption
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm/schema"
+)
+
+func init() {
+	schema.RegisterSerializer("encrypted", Serializer{})
+}
+
+// ownerColumn is the column binding the encrypted values to their row
+const ownerColumn = "user_id"
+
+// Serializer transparently encrypts string fields tagged `gorm:"serializer:encrypted"`.
+// The column name and the user_id of the row are used as additional data so
+// values cannot be swapped between columns nor copied to the row of another
+// user. The user_id must be selected before the encrypted columns. Empty
+// strings are stored as is.
+type Serializer struct{}
+
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		value = v
+	case []byte:
+		value = string(v)
+	default:
+		return fmt.Errorf("failed to decrypt %s: unsupported value %T", field.DBName, dbValue)
+	}
+
+	if value != "" {
+		aad := field.DBName
+		if !Legacy(value) {
+			var err error
+			if aad, err = rowAAD(ctx, field, dst); err != nil {
+				return fmt.Errorf("failed to decrypt %s: %w", field.DBName, err)
+			}
+		}
+		plaintext, err := Decrypt(value, aad)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", field.DBName, err)
+		}
+		value = plaintext
+	}
+	field.ReflectValueOf(ctx, dst).SetString(value)
+	return nil
+}
+
+func (Serializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("failed to encrypt %s: unsupported value %T", field.DBName, fieldValue)
+	}
+	if value == "" {
+		return "", nil
+	}
+	aad, err := rowAAD(ctx, field, dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt %s: %w", field.DBName, err)
+	}
+	ciphertext, err := Encrypt(value, aad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt %s: %w", field.DBName, err)
+	}
+	return ciphertext, nil
+}
+
+// rowAAD binds the value of the field to its column and to the owner of the row
+func rowAAD(ctx context.Context, field *schema.Field, dst reflect.Value) (string, error) {
+	owner := field.Schema.LookUpField(ownerColumn)
+	if owner == nil {
+		return "", fmt.Errorf("%s has no %s to bind the value to", field.Schema.Name, ownerColumn)
+	}
+	ownerValue, zero := owner.ValueOf(ctx, dst)
+	if zero {
+		return "", fmt.Errorf("%s is not set", ownerColumn)
+	}
+	return fmt.Sprintf("%s:%v", field.DBName, ownerValue), nil
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/VincentBaron/bangr/backend/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type AccountHandler struct {
+	accountService *services.AccountService
+}
+
+func NewAccountHandler(accountService *services.AccountService) *AccountHandler {
+	return &AccountHandler{
+		accountService: accountService,
+	}
+}
+
+func (h *AccountHandler) DeleteMe(c *gin.Context) {
+	resp, err := h.accountService.ScheduleDeletion(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusAccepted, resp)
+}
+
+func (h *AccountHandler) RestoreMe(c *gin.Context) {
+	if err := h.accountService.Restore(c); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrDeletionNotScheduled) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/VincentBaron/bangr/backend/internal/dto"
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const maxAdminLimit = 100
+
+type AdminHandler struct {
+	adminService    *services.AdminService
+	cronRunService  *services.CronRunService
+	houseSetService *services.HouseSetService
+	roundService    *services.RoundService
+}
+
+func NewAdminHandler(adminService *services.AdminService, cronRunService *services.CronRunService, houseSetService *services.HouseSetService, roundService *services.RoundService) *AdminHandler {
+	return &AdminHandler{
+		adminService:    adminService,
+		cronRunService:  cronRunService,
+		houseSetService: houseSetService,
+		roundService:    roundService,
+	}
+}
+
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	var queryParams models.AdminUserQueryParams
+	if err := c.ShouldBindQuery(&queryParams); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if queryParams.Limit < 1 || queryParams.Limit > maxAdminLimit || queryParams.Offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination, expected a limit between 1 and 100"})
+		return
+	}
+
+	users, err := h.adminService.ListUsers(queryParams)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	id, ok := bindUserID(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.adminService.GetUser(id)
+	if err != nil {
+		respondAdminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+func (h *AdminHandler) BanUser(c *gin.Context) {
+	id, ok := bindUserID(c)
+	if !ok {
+		return
+	}
+	var payload dto.PostBanReq
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Failed to read body",
+		})
+		return
+	}
+
+	user, err := h.adminService.Ban(c, id, payload.Reason)
+	if err != nil {
+		respondAdminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+func (h *AdminHandler) UnbanUser(c *gin.Context) {
+	id, ok := bindUserID(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.adminService.Unban(c, id)
+	if err != nil {
+		respondAdminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+func (h *AdminHandler) ResyncUser(c *gin.Context) {
+	id, ok := bindUserID(c)
+	if !ok {
+		return
+	}
+
+	set, err := h.adminService.Resync(c, id)
+	if err != nil {
+		respondAdminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, set)
+}
+
+func (h *AdminHandler) ListCronRuns(c *gin.Context) {
+	var queryParams models.CronRunQueryParams
+	if err := c.ShouldBindQuery(&queryParams); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if queryParams.Limit < 1 || queryParams.Limit > maxAdminLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit, expected a value between 1 and 100"})
+		return
+	}
+
+	runs, err := h.cronRunService.List(queryParams)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, runs)
+}
+
+func (h *AdminHandler) ListHouseSets(c *gin.Context) {
+	houseSets, err := h.houseSetService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, houseSets)
+}
+
+func (h *AdminHandler) CreateHouseSet(c *gin.Context) {
+	var payload dto.PostHouseSetReq
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	houseSet, err := h.houseSetService.Create(c, payload)
+	if err != nil {
+		respondAdminError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, houseSet)
+}
+
+func (h *AdminHandler) UpdateHouseSet(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid house set id"})
+		return
+	}
+	var payload dto.PatchHouseSetReq
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	houseSet, err := h.houseSetService.Update(c, id, payload)
+	if err != nil {
+		respondAdminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, houseSet)
+}
+
+func (h *AdminHandler) DeleteHouseSet(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid house set id"})
+		return
+	}
+
+	if err := h.houseSetService.Delete(id); err != nil {
+		respondAdminError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AdminHandler) GetRoundSchedule(c *gin.Context) {
+	schedule, err := h.roundService.Schedule()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, schedule)
+}
+
+func (h *AdminHandler) UpdateRoundSchedule(c *gin.Context) {
+	var payload dto.PutRoundScheduleReq
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	schedule, err := h.roundService.UpdateSchedule(payload)
+	if err != nil {
+		respondAdminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, schedule)
+}
+
+func (h *AdminHandler) UpdateRound(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid round id"})
+		return
+	}
+	var payload dto.PatchRoundReq
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	round, err := h.roundService.Update(id, payload)
+	if err != nil {
+		respondAdminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, round)
+}
+
+func bindUserID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func respondAdminError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrHouseSetNotFound),
+		errors.Is(err, services.ErrRoundNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrCannotBanSelf),
+		errors.Is(err, services.ErrInvalidHouseSetDates),
+		errors.Is(err, services.ErrUnknownGenre),
+		errors.Is(err, services.ErrInvalidTrackURI),
+		errors.Is(err, services.ErrEpisodeNotAllowed),
+		errors.Is(err, services.ErrTrackUnplayable),
+		errors.Is(err, services.ErrDuplicateTrack),
+		errors.Is(err, services.ErrTooManyTracks),
+		errors.Is(err, services.ErrInvalidRoundSchedule),
+		errors.Is(err, services.ErrInvalidRoundDates),
+		errors.Is(err, services.ErrInvalidSetSize),
+		errors.Is(err, services.ErrInvalidSetSelection):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrSetFrozen), errors.Is(err, services.ErrSubmissionsClosed):
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{
+		"error": err.Error(),
+	})
+}
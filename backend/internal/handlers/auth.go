@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"errors"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
 
 	"github.com/VincentBaron/bangr/backend/internal/dto"
 	"github.com/VincentBaron/bangr/backend/internal/services"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 type AuthHandler struct {
@@ -31,14 +35,94 @@ func (h *AuthHandler) CallbackHandler(c *gin.Context) {
 		return
 	}
 
-	if err := h.authService.CallbackService(c); err != nil {
+	redirectURL, err := h.authService.CallbackService(c)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
 		c.Redirect(http.StatusTemporaryRedirect, os.Getenv("FRONTEND_URL"))
 		return
 	}
-	c.Redirect(http.StatusTemporaryRedirect, os.Getenv("FRONTEND_URL"))
+	c.Redirect(http.StatusTemporaryRedirect, redirectURL)
+}
+
+func (h *AuthHandler) SpotifyLogin(c *gin.Context) {
+	url, err := h.authService.SpotifyLogin(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"url": url})
+}
+
+func (h *AuthHandler) SpotifyExchange(c *gin.Context) {
+	var payload dto.PostLoginCodeReq
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Failed to read body",
+		})
+		return
+	}
+
+	tokens, err := h.authService.ExchangeLoginCode(c, payload.Code)
+	if errors.Is(err, services.ErrInvalidLoginCode) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, services.ErrAccountBanned) {
+		c.JSON(http.StatusForbidden, dto.ErrorResp{Error: err.Error(), Code: dto.ErrorCodeBanned})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (h *AuthHandler) LinkSpotify(c *gin.Context) {
+	url, err := h.authService.LinkSpotify(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"url": url})
+}
+
+func (h *AuthHandler) RelinkSpotify(c *gin.Context) {
+	url, err := h.authService.RelinkSpotify(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"url": url})
+}
+
+func (h *AuthHandler) UnlinkSpotify(c *gin.Context) {
+	err := h.authService.UnlinkSpotify(c)
+	if errors.Is(err, services.ErrPasswordRequired) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.Status(http.StatusNoContent)
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -56,14 +140,109 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	err := h.authService.Login(c, body.Username, body.Password)
+	tokens, err := h.authService.Login(c, body.Username, body.Password)
+	var locked *services.LoginLockedError
+	if errors.As(err, &locked) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidCredentials) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, services.ErrAccountBanned) {
+		c.JSON(http.StatusForbidden, dto.ErrorResp{Error: err.Error(), Code: dto.ErrorCodeBanned})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var payload dto.PostRefreshReq
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Failed to read body",
+		})
+		return
+	}
+
+	tokens, err := h.authService.Refresh(c, payload.RefreshToken)
+	if errors.Is(err, services.ErrInvalidRefreshToken) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (h *AuthHandler) Logout(c *gin.Context) {
+	if err := h.authService.Logout(c); err != nil && !errors.Is(err, services.ErrSessionNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	if err := h.authService.LogoutAll(c); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AuthHandler) GetSessions(c *gin.Context) {
+	sessions, err := h.authService.GetSessions(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+func (h *AuthHandler) DeleteSession(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	err = h.authService.RevokeSession(c, id)
+	if errors.Is(err, services.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{})
+	c.Status(http.StatusNoContent)
 }
 
 func (h *AuthHandler) Signup(c *gin.Context) {
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/VincentBaron/bangr/backend/internal/dto"
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type ExportHandler struct {
+	exportService *services.ExportService
+}
+
+func NewExportHandler(exportService *services.ExportService) *ExportHandler {
+	return &ExportHandler{
+		exportService: exportService,
+	}
+}
+
+func (h *ExportHandler) Export(c *gin.Context) {
+	archive, export, err := h.exportService.Export(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	respondExport(c, archive, export)
+}
+
+func (h *ExportHandler) GetExport(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid export id",
+		})
+		return
+	}
+
+	archive, export, err := h.exportService.GetExport(c, id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrExportNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	respondExport(c, archive, export)
+}
+
+// respondExport sends the archive when built, the status of the export otherwise
+func respondExport(c *gin.Context, archive []byte, export *dto.GetDataExportResp) {
+	if archive != nil {
+		c.Header("Content-Disposition", `attachment; filename="bangr-export.zip"`)
+		c.Header("Cache-Control", "no-store")
+		c.Data(http.StatusOK, "application/zip", archive)
+		return
+	}
+	status := http.StatusAccepted
+	if export.Status != models.DataExportStatusPending {
+		status = http.StatusOK
+	}
+	c.JSON(status, export)
+}
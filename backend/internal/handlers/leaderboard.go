@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
+	"github.com/VincentBaron/bangr/backend/internal/models"
 	"github.com/VincentBaron/bangr/backend/internal/services"
 	"github.com/gin-gonic/gin"
 )
 
+const maxLeaderboardLimit = 100
+
 type LeaderboardHandler struct {
 	leaderboardService *services.LeaderboardService
 }
@@ -18,7 +22,20 @@ func NewLeaderboardHandler(leaderboardService *services.LeaderboardService) *Lea
 }
 
 func (h *LeaderboardHandler) GetLeaderboard(c *gin.Context) {
-	leaderboard, err := h.leaderboardService.GetLeaderboard(c)
+	queryParams, ok := bindLeaderboardQuery(c)
+	if !ok {
+		return
+	}
+	if queryParams.Limit < 1 || queryParams.Limit > maxLeaderboardLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit, expected a value between 1 and 100"})
+		return
+	}
+
+	leaderboard, err := h.leaderboardService.GetLeaderboard(c, queryParams)
+	if errors.Is(err, services.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
@@ -27,3 +44,32 @@ func (h *LeaderboardHandler) GetLeaderboard(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, leaderboard)
 }
+
+func (h *LeaderboardHandler) GetMyStanding(c *gin.Context) {
+	queryParams, ok := bindLeaderboardQuery(c)
+	if !ok {
+		return
+	}
+
+	standing, err := h.leaderboardService.GetMyStanding(c, queryParams.Period)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, standing)
+}
+
+func bindLeaderboardQuery(c *gin.Context) (models.LeaderboardQueryParams, bool) {
+	var queryParams models.LeaderboardQueryParams
+	if err := c.ShouldBindQuery(&queryParams); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return queryParams, false
+	}
+	if !queryParams.Period.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid period, expected week, month, season or all"})
+		return queryParams, false
+	}
+	return queryParams, true
+}
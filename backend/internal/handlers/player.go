@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"net/http"
 
+	"github.com/VincentBaron/bangr/backend/internal/dto"
 	"github.com/VincentBaron/bangr/backend/internal/models"
 	"github.com/VincentBaron/bangr/backend/internal/services"
 	"github.com/gin-gonic/gin"
@@ -38,6 +40,10 @@ func (h *PlayerHandler) Player(c *gin.Context) {
 	}
 
 	player, err := h.playerService.HandlePlayer(c, spotifyClient, queryParams)
+	if errors.Is(err, services.ErrPremiumRequired) {
+		c.JSON(http.StatusForbidden, dto.ErrorResp{Error: err.Error(), Code: dto.ErrorCodePremiumRequired})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const maxRoundsLimit = 100
+
+type RoundHandler struct {
+	roundService       *services.RoundService
+	roundResultService *services.RoundResultService
+}
+
+func NewRoundHandler(roundService *services.RoundService, roundResultService *services.RoundResultService) *RoundHandler {
+	return &RoundHandler{
+		roundService:       roundService,
+		roundResultService: roundResultService,
+	}
+}
+
+func (h *RoundHandler) GetCurrentRound(c *gin.Context) {
+	round, err := h.roundService.CurrentResp()
+	if errors.Is(err, services.ErrRoundNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, round)
+}
+
+func (h *RoundHandler) ListRounds(c *gin.Context) {
+	var queryParams models.RoundQueryParams
+	if err := c.ShouldBindQuery(&queryParams); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if queryParams.Limit < 1 || queryParams.Limit > maxRoundsLimit || queryParams.Offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination, expected a limit between 1 and 100"})
+		return
+	}
+
+	rounds, err := h.roundService.List(queryParams)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, rounds)
+}
+
+func (h *RoundHandler) GetRoundResults(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid round id"})
+		return
+	}
+
+	results, err := h.roundResultService.Results(id)
+	switch {
+	case errors.Is(err, services.ErrRoundNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrRoundNotClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
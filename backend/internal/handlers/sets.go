@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
+	"github.com/VincentBaron/bangr/backend/internal/dto"
 	"github.com/VincentBaron/bangr/backend/internal/models"
 	"github.com/VincentBaron/bangr/backend/internal/services"
 	"github.com/gin-gonic/gin"
@@ -10,6 +12,8 @@ import (
 	"github.com/zmb3/spotify/v2"
 )
 
+const maxSetsLimit = 100
+
 type SetHandler struct {
 	setService *services.SetService
 }
@@ -31,6 +35,105 @@ func (h *SetHandler) GetSets(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"sets": sets})
 }
 
+func (h *SetHandler) GetSet(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid set id"})
+		return
+	}
+
+	set, err := h.setService.GetSet(c, id)
+	if errors.Is(err, services.ErrSetNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, set)
+}
+
+func (h *SetHandler) GetRoundSets(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid round id"})
+		return
+	}
+	queryParams, ok := bindSetQuery(c)
+	if !ok {
+		return
+	}
+
+	sets, err := h.setService.GetRoundSets(c, id, queryParams)
+	if errors.Is(err, services.ErrRoundNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sets)
+}
+
+func (h *SetHandler) GetUserSets(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+	queryParams, ok := bindSetQuery(c)
+	if !ok {
+		return
+	}
+
+	sets, err := h.setService.GetUserSets(c, id, queryParams)
+	if errors.Is(err, services.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sets)
+}
+
+func (h *SetHandler) Submit(c *gin.Context) {
+	var payload dto.PostSubmissionReq
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	submission, created, err := h.setService.Submit(c, payload)
+	switch {
+	case errors.Is(err, services.ErrSubmissionsClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrSetTooLarge),
+		errors.Is(err, services.ErrInvalidTrackURI),
+		errors.Is(err, services.ErrEpisodeNotAllowed),
+		errors.Is(err, services.ErrTrackUnplayable),
+		errors.Is(err, services.ErrDuplicateTrack):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrPlaylistMirrorFailed):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, submission)
+}
+
 func (h *SetHandler) ToggleLikeTrack(c *gin.Context) {
 
 	var queryParams models.LikeQueryParams
@@ -47,6 +150,10 @@ func (h *SetHandler) ToggleLikeTrack(c *gin.Context) {
 	}
 
 	err = h.setService.ToggleLikeTrack(c, id, queryParams)
+	if errors.Is(err, services.ErrRoundClosed) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -74,6 +181,10 @@ func (h *SetHandler) CreateSet(c *gin.Context) {
 	}
 
 	set, err := h.setService.CreateSet(user.SpotifyUserID, set, spotifyClient)
+	if errors.Is(err, services.ErrSetExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -82,3 +193,16 @@ func (h *SetHandler) CreateSet(c *gin.Context) {
 	// Return the set
 	c.JSON(http.StatusOK, gin.H{"set": set})
 }
+
+func bindSetQuery(c *gin.Context) (models.SetQueryParams, bool) {
+	var queryParams models.SetQueryParams
+	if err := c.ShouldBindQuery(&queryParams); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return queryParams, false
+	}
+	if queryParams.Limit < 1 || queryParams.Limit > maxSetsLimit || queryParams.Offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination, expected a limit between 1 and 100"})
+		return queryParams, false
+	}
+	return queryParams, true
+}
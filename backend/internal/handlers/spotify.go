@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/VincentBaron/bangr/backend/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type SpotifyHandler struct {
+	spotifyService *services.SpotifyService
+}
+
+func NewSpotifyHandler(spotifyService *services.SpotifyService) *SpotifyHandler {
+	return &SpotifyHandler{
+		spotifyService: spotifyService,
+	}
+}
+
+func (h *SpotifyHandler) GetToken(c *gin.Context) {
+	token, err := h.spotifyService.GetToken(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The token grants access to the user's Spotify account, never cache it
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, token)
+}
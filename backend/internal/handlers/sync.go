@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/VincentBaron/bangr/backend/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type SyncHandler struct {
+	syncService *services.SyncService
+}
+
+func NewSyncHandler(syncService *services.SyncService) *SyncHandler {
+	return &SyncHandler{
+		syncService: syncService,
+	}
+}
+
+func (h *SyncHandler) GetSyncIssues(c *gin.Context) {
+	issues, err := h.syncService.Issues(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"issues": issues})
+}
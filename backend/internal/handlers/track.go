@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const maxTrackLikesLimit = 100
+
+type TrackHandler struct {
+	trackService *services.TrackService
+}
+
+func NewTrackHandler(trackService *services.TrackService) *TrackHandler {
+	return &TrackHandler{
+		trackService: trackService,
+	}
+}
+
+func (h *TrackHandler) GetTrack(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid track ID"})
+		return
+	}
+
+	track, err := h.trackService.Get(c, id)
+	if errors.Is(err, services.ErrTrackNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, track)
+}
+
+func (h *TrackHandler) GetTrackLikes(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid track ID"})
+		return
+	}
+	var queryParams models.TrackLikesQueryParams
+	if err := c.ShouldBindQuery(&queryParams); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if queryParams.Limit < 1 || queryParams.Limit > maxTrackLikesLimit || queryParams.Offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination, expected a limit between 1 and 100"})
+		return
+	}
+
+	likes, err := h.trackService.GetLikes(c, id, queryParams)
+	switch {
+	case errors.Is(err, services.ErrTrackNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrInvalidRoundID):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, likes)
+}
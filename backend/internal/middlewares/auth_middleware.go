@@ -1,28 +1,47 @@
 package middlewares
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"time"
 
-	"github.com/VincentBaron/bangr/backend/internal/config"
+	"github.com/VincentBaron/bangr/backend/internal/dto"
 	"github.com/VincentBaron/bangr/backend/internal/models"
 	"github.com/VincentBaron/bangr/backend/internal/repositories"
+	"github.com/VincentBaron/bangr/backend/internal/services"
+	"github.com/VincentBaron/bangr/backend/internal/tokenstore"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/zmb3/spotify/v2"
-	spotifyauth "github.com/zmb3/spotify/v2/auth"
-	"golang.org/x/oauth2"
 )
 
+// pendingDeletionRoutes are the routes left to the users whose account is
+// scheduled for deletion, enough to restore it or take their data away
+var pendingDeletionRoutes = map[string]bool{
+	"GET /me":            true,
+	"POST /me/restore":   true,
+	"GET /me/export":     true,
+	"GET /me/export/:id": true,
+	"POST /logout":       true,
+	"POST /logout-all":   true,
+}
+
 type Middleware struct {
-	userRepository *repositories.Repository[models.User]
+	userRepository    *repositories.Repository[models.User]
+	sessionRepository *repositories.Repository[models.Session]
+	tokenStore        *tokenstore.Store
 }
 
-func NewMiddleware(userRepository *repositories.Repository[models.User]) *Middleware {
-	return &Middleware{userRepository: userRepository}
+func NewMiddleware(userRepository *repositories.Repository[models.User], sessionRepository *repositories.Repository[models.Session], tokenStore *tokenstore.Store) *Middleware {
+	return &Middleware{
+		userRepository:    userRepository,
+		sessionRepository: sessionRepository,
+		tokenStore:        tokenStore,
+	}
 }
 
 func (m *Middleware) RequireAuth(c *gin.Context) {
@@ -60,81 +79,99 @@ func (m *Middleware) RequireAuth(c *gin.Context) {
 		return
 	}
 
+	// Reject tokens of revoked sessions
+	sessionID, ok := claims["sid"].(string)
+	if !ok {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	session, err := m.sessionRepository.FindByFilter(map[string]interface{}{"id": sessionID, "user_id": claims["sub"]})
+	if err != nil || session.RevokedAt != nil || session.ExpiresAt.Before(time.Now()) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
 	// Find the user with token Subject
-	user, err := m.userRepository.FindByFilter(map[string]interface{}{"id": claims["sub"]}, "SpotifyToken")
+	user, err := m.userRepository.FindByFilter(map[string]interface{}{"id": claims["sub"]})
 	if err != nil || user.ID == uuid.Nil {
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
 
-	// Check if the Spotify token has expired
-	spotifyToken := oauth2.Token{
-		AccessToken:  user.SpotifyToken.AccessToken,
-		TokenType:    "Bearer",
-		RefreshToken: user.SpotifyToken.RefreshToken,
-		Expiry:       user.SpotifyToken.Expiry,
+	if user.BannedAt != nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, dto.ErrorResp{Error: services.ErrAccountBanned.Error(), Code: dto.ErrorCodeBanned})
+		return
 	}
-	httpClient := spotifyauth.New().Client(c, &spotifyToken)
-	client := spotify.New(httpClient)
-	oauthConf := &oauth2.Config{
-		ClientID:     config.Conf.SpotifyClientID,
-		ClientSecret: config.Conf.SpotifyClientSecret,
-		Endpoint: oauth2.Endpoint{
-			TokenURL: spotifyauth.TokenURL,
-		},
+	if user.DeletionScheduledAt != nil && !pendingDeletionRoutes[c.Request.Method+" "+c.FullPath()] {
+		c.AbortWithStatusJSON(http.StatusForbidden, dto.ErrorResp{Error: services.ErrDeletionScheduled.Error(), Code: dto.ErrorCodeDeletionScheduled})
+		return
 	}
-	if spotifyToken.Expiry.Before(time.Now()) {
-		src := oauthConf.TokenSource(c, &spotifyToken)
-		token, err := src.Token()
-		if err != nil {
-			fmt.Printf("Couldn't refresh token: %v\n", err)
-			c.AbortWithStatus(http.StatusUnauthorized)
-			return
-		}
 
-		newSpotifyToken := models.SpotifyToken{
-			AccessToken:  token.AccessToken,
-			RefreshToken: token.RefreshToken,
-			Expiry:       token.Expiry,
-		}
-		user.SpotifyToken = newSpotifyToken
-
-		// Begin a transaction
-		tx := config.DB.Begin()
-
-		if err := tx.Model(&user).Association("SpotifyToken").Replace(&newSpotifyToken); err != nil {
-			tx.Rollback()
-			c.AbortWithStatus(http.StatusInternalServerError)
-			return
-		}
-		tx.Model(&user).Save(&user)
-
-		// Commit the transaction
-		if err := tx.Commit().Error; err != nil {
-			c.AbortWithStatus(http.StatusInternalServerError)
-			return
-		}
-
-		httpClient = spotifyauth.New().Client(c, token)
-		client = spotify.New(httpClient)
-		user.SpotifyToken = newSpotifyToken
-		fmt.Printf("Token refreshed for user %s\n", user.ID.String())
+	// Create a Spotify client, the store refreshes the token ahead of expiry.
+	// Without one, users only get access to the routes not requiring Spotify
+	// so that they can still link it again.
+	var client *spotify.Client
+	if user.NeedsReauth {
+		err = tokenstore.ErrReauthRequired
+	} else {
+		client, err = m.tokenStore.Client(c, user.ID)
+	}
+	switch {
+	case errors.Is(err, tokenstore.ErrNotLinked), errors.Is(err, tokenstore.ErrReauthRequired):
+		c.Set("spotifyError", err)
+	case err != nil:
+		log.Printf("Couldn't get Spotify client of user %s: %v", user.ID, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	default:
+		c.Set("spotifyClient", client)
 	}
 
-	// Create a new Spotify client with the refreshed token
-	SetTokens(c, tokenString, user.SpotifyToken.AccessToken, user.ID.String())
-	c.Set("spotifyClient", client)
+	SetTokens(c, tokenString, user.ID.String())
 
 	// Attach the request
 	c.Set("user", user)
+	c.Set("session", session)
 
 	// Continue
 	c.Next()
 }
 
-func SetTokens(c *gin.Context, tokenString string, spotifyToken string, userID string) {
+func SetTokens(c *gin.Context, tokenString string, userID string) {
 	// Add tokens to the response headers
 	c.Header("Authorization", tokenString)
-	c.Header("SpotifyAuthorization", spotifyToken)
 	c.Header("UserID", userID)
 }
+
+// RequireSpotify rejects the users without a working Spotify account with an
+// error code telling the frontend whether to link or relink it. It must run
+// after RequireAuth.
+func (m *Middleware) RequireSpotify(c *gin.Context) {
+	if _, ok := c.Get("spotifyClient"); ok {
+		c.Next()
+		return
+	}
+
+	code := dto.ErrorCodeSpotifyNotLinked
+	err := tokenstore.ErrNotLinked
+	if spotifyErr, ok := c.Get("spotifyError"); ok && errors.Is(spotifyErr.(error), tokenstore.ErrReauthRequired) {
+		code = dto.ErrorCodeSpotifyReauthRequired
+		err = tokenstore.ErrReauthRequired
+	}
+	c.AbortWithStatusJSON(http.StatusForbidden, dto.ErrorResp{Error: err.Error(), Code: code})
+}
+
+// RequireRole rejects the users without one of the roles, it must run after
+// RequireAuth
+func (m *Middleware) RequireRole(roles ...models.UserRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet("user").(*models.User)
+		for _, role := range roles {
+			if user.Role == role {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient role"})
+	}
+}
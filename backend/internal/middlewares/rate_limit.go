@@ -0,0 +1,99 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/VincentBaron/bangr/backend/internal/dto"
+	"github.com/VincentBaron/bangr/backend/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// maxPeekedBody bounds the body read before authentication to find the username
+const maxPeekedBody = 1 << 20
+
+// RouteLimits are the limits of a route group, keyed by client IP and by the
+// username of the JSON body
+type RouteLimits struct {
+	PerIP       ratelimit.Limit
+	PerUsername ratelimit.Limit
+}
+
+type RateLimitMiddleware struct {
+	limiter ratelimit.Limiter
+}
+
+func NewRateLimitMiddleware(limiter ratelimit.Limiter) *RateLimitMiddleware {
+	return &RateLimitMiddleware{
+		limiter: limiter,
+	}
+}
+
+// Limit throttles the routes of group, answering 429 with a Retry-After
+// header. The limiter failing lets requests through rather than taking the
+// API down with it.
+func (m *RateLimitMiddleware) Limit(group string, limits RouteLimits) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		type bucket struct {
+			key   string
+			limit ratelimit.Limit
+		}
+		buckets := make([]bucket, 0, 2)
+		if limits.PerIP.Enabled() {
+			buckets = append(buckets, bucket{group + ":ip:" + c.ClientIP(), limits.PerIP})
+		}
+		if limits.PerUsername.Enabled() {
+			username, err := peekUsername(c)
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+				return
+			}
+			if username != "" {
+				buckets = append(buckets, bucket{group + ":username:" + username, limits.PerUsername})
+			}
+		}
+
+		for _, b := range buckets {
+			allowed, retryAfter, err := m.limiter.Allow(c, b.key, b.limit)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			if !allowed {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, dto.ErrorResp{Error: "too many requests", Code: dto.ErrorCodeRateLimited})
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// peekUsername reads the username of a JSON body, leaving the body for the
+// handler. Bodies over maxPeekedBody are refused.
+func peekUsername(c *gin.Context) (string, error) {
+	if c.Request.Body == nil {
+		return "", nil
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPeekedBody))
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+
+	var payload struct {
+		Username string `json:"username"`
+	}
+	if json.Unmarshal(body, &payload) != nil {
+		return "", nil
+	}
+	return strings.ToLower(strings.TrimSpace(payload.Username)), nil
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AuditEventType string
+
+const (
+	AuditEventLoginSucceeded AuditEventType = "login_succeeded"
+	AuditEventLoginFailed    AuditEventType = "login_failed"
+	AuditEventLoginLocked    AuditEventType = "login_locked"
+	AuditEventUserBanned     AuditEventType = "user_banned"
+	AuditEventUserUnbanned   AuditEventType = "user_unbanned"
+	AuditEventUserResynced   AuditEventType = "user_resynced"
+)
+
+// AuditEvent records a security relevant action, UserID is unset when the
+// username matches no account
+type AuditEvent struct {
+	ID        uuid.UUID      `gorm:"type:uuid;default:uuid_generate_v4()"`
+	CreatedAt time.Time      `gorm:"index"`
+	Type      AuditEventType `gorm:"not null;index"`
+	UserID    *uuid.UUID     `gorm:"type:uuid;index"`
+	Username  string
+	IP        string
+	UserAgent string
+	Details   string
+}
+
+// LoginAttempt counts the consecutive failed logins of a username, which is
+// locked out until LockedUntil once they pile up
+type LoginAttempt struct {
+	Username      string `gorm:"primaryKey"`
+	Failures      int    `gorm:"not null;default:0"`
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
@@ -16,6 +16,19 @@ type Config struct {
 	SpotifyRedirectURL  string `yaml:"spotify_redirect_url"`
 	SpotifyScopes       string `yaml:"spotify_scopes"`
 	BuyMeACoffeeAPIKey  string `yaml:"buymeacoffee_api_key"`
+	// TokenEncryptionKeys lists the master keys as comma separated id:base64key pairs
+	TokenEncryptionKeys  string `yaml:"token_encryption_keys"`
+	TokenEncryptionKeyID string `yaml:"token_encryption_key_id"`
+	// RateLimitBackend is memory or postgres, the latter shares limits across replicas
+	RateLimitBackend string `yaml:"rate_limit_backend"`
+	// RateLimits overrides the limits of the route groups, e.g. login.ip: 10/1m
+	RateLimits map[string]string `yaml:"rate_limits"`
+	// TrustedProxies lists the proxies, as IPs or CIDRs, whose X-Forwarded-For
+	// header gives the client IP keying the rate limits. None are trusted by default.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// TrustedPlatform is the header set by the hosting platform with the client
+	// IP, e.g. CF-Connecting-IP, used instead of the trusted proxies
+	TrustedPlatform string `yaml:"trusted_platform"`
 }
 
 type HandlerConfig struct {
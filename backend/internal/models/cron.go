@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type CronRunStatus string
+
+const (
+	CronRunStatusRunning   CronRunStatus = "running"
+	CronRunStatusSucceeded CronRunStatus = "succeeded"
+	CronRunStatusFailed    CronRunStatus = "failed"
+)
+
+// CronRun records an execution of a background job
+type CronRun struct {
+	ID         uuid.UUID     `gorm:"type:uuid;default:uuid_generate_v4()" json:"id"`
+	Job        string        `gorm:"not null;index" json:"job"`
+	StartedAt  time.Time     `gorm:"not null;index" json:"started_at"`
+	FinishedAt *time.Time    `json:"finished_at"`
+	Status     CronRunStatus `gorm:"not null" json:"status"`
+	Error      string        `json:"error,omitempty"`
+}
+
+type CronRunQueryParams struct {
+	Job   string `form:"job"`
+	Limit int    `form:"limit,default=50"`
+}
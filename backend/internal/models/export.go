@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type DataExportStatus string
+
+const (
+	DataExportStatusPending DataExportStatus = "pending"
+	DataExportStatusReady   DataExportStatus = "ready"
+	DataExportStatusFailed  DataExportStatus = "failed"
+)
+
+// DataExport is a personal data archive too large to build during the
+// request, the cron job builds it and it is kept until ExpiresAt
+type DataExport struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4()"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	UserID      uuid.UUID        `gorm:"type:uuid;not null;index"`
+	Status      DataExportStatus `gorm:"not null;default:pending;index"`
+	Archive     []byte
+	Error       string
+	CompletedAt *time.Time
+	ExpiresAt   *time.Time `gorm:"index"`
+}
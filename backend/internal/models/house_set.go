@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// HouseSet is a set curated by the admins, shown while too few users
+// submitted a set during the round
+type HouseSet struct {
+	ID            uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4()" json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"-"`
+	Name          string    `gorm:"not null" json:"name"`
+	Curator       string    `json:"curator"`
+	ProfilePicURL string    `json:"profile_pic_url"`
+	Link          string    `json:"link"`
+	StartsAt      time.Time `gorm:"not null;index" json:"starts_at"`
+	// EndsAt is unset for house sets shown until removed
+	EndsAt       *time.Time `gorm:"index" json:"ends_at"`
+	DisplayOrder int        `gorm:"not null;default:0" json:"display_order"`
+	// Genres target the viewers sharing one of them, empty targets everyone
+	Genres []Genre `gorm:"many2many:house_set_genres;" json:"genres"`
+	Tracks []Track `gorm:"many2many:house_set_tracks;" json:"tracks"`
+}
+
+// ActiveAt tells whether the house set is shown at t
+func (h *HouseSet) ActiveAt(t time.Time) bool {
+	return !h.StartsAt.After(t) && (h.EndsAt == nil || h.EndsAt.After(t))
+}
+
+// Targets tells whether the house set is meant for a viewer with the genres
+func (h *HouseSet) Targets(genres map[GenreName]bool) bool {
+	if len(h.Genres) == 0 {
+		return true
+	}
+	for _, genre := range h.Genres {
+		if genres[genre.Name] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type LeaderboardPeriod string
+
+const (
+	LeaderboardPeriodWeek   LeaderboardPeriod = "week"
+	LeaderboardPeriodMonth  LeaderboardPeriod = "month"
+	LeaderboardPeriodSeason LeaderboardPeriod = "season"
+	LeaderboardPeriodAll    LeaderboardPeriod = "all"
+)
+
+var LeaderboardPeriods = []LeaderboardPeriod{
+	LeaderboardPeriodWeek,
+	LeaderboardPeriodMonth,
+	LeaderboardPeriodSeason,
+	LeaderboardPeriodAll,
+}
+
+func (p LeaderboardPeriod) Valid() bool {
+	for _, period := range LeaderboardPeriods {
+		if p == period {
+			return true
+		}
+	}
+	return false
+}
+
+// LeaderboardStanding is the materialized count of likes a user received
+// during the period starting at PeriodStart, weeks being the rounds
+type LeaderboardStanding struct {
+	Period      LeaderboardPeriod `gorm:"primaryKey;index:idx_leaderboard_standings_rank,priority:1"`
+	PeriodStart time.Time         `gorm:"primaryKey;index:idx_leaderboard_standings_rank,priority:2"`
+	UserID      uuid.UUID         `gorm:"type:uuid;primaryKey"`
+	User        User
+	Likes       int `gorm:"not null;default:0;index:idx_leaderboard_standings_rank,priority:3,sort:desc"`
+	UpdatedAt   time.Time
+	// RoundID is the round of the weekly standings
+	RoundID *uuid.UUID `gorm:"type:uuid;index"`
+}
+
+type LeaderboardQueryParams struct {
+	Period LeaderboardPeriod `form:"period,default=week"`
+	Limit  int               `form:"limit,default=50"`
+	Cursor string            `form:"cursor"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type OAuthPurpose string
+
+const (
+	// OAuthPurposeSignup attaches Spotify to a user created with a password
+	OAuthPurposeSignup OAuthPurpose = "signup"
+	// OAuthPurposeLogin finds or creates the user owning the Spotify account
+	OAuthPurposeLogin OAuthPurpose = "login"
+	// OAuthPurposeLink attaches Spotify to the signed in user
+	OAuthPurposeLink OAuthPurpose = "link"
+	// OAuthPurposeRelink renews the token of the signed in user after Spotify
+	// revoked their grant
+	OAuthPurposeRelink OAuthPurpose = "relink"
+)
+
+// OAuthState ties a pending Spotify authorization to the user who started it
+type OAuthState struct {
+	State     string `gorm:"primaryKey"`
+	CreatedAt time.Time
+	ExpiresAt time.Time    `gorm:"not null;index"`
+	Purpose   OAuthPurpose `gorm:"not null;default:signup"`
+	// UserID is empty when signing in with Spotify
+	UserID *uuid.UUID `gorm:"type:uuid"`
+	// CodeVerifier is the PKCE secret the authorization code is exchanged with.
+	// The states started before PKCE have none and fail their callback.
+	CodeVerifier string `gorm:"not null;default:''"`
+}
+
+// LoginCode is handed to the frontend after signing in with Spotify and
+// exchanged once for a session
+type LoginCode struct {
+	CodeHash  string `gorm:"primaryKey"`
+	CreatedAt time.Time
+	ExpiresAt time.Time `gorm:"not null;index"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null"`
+}
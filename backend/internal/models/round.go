@@ -0,0 +1,213 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultSetSize is the number of tracks a set holds unless the round says otherwise
+	DefaultSetSize = 3
+	// MaxSetSize is the number of tracks Spotify resolves in one request
+	MaxSetSize = 50
+)
+
+// SetSelection picks the tracks of the sets synced from the playlists
+type SetSelection string
+
+const (
+	// SetSelectionFirst takes the tracks at the top of the playlist
+	SetSelectionFirst SetSelection = "first"
+	// SetSelectionRecent takes the tracks added last to the playlist
+	SetSelectionRecent SetSelection = "recent"
+	// SetSelectionRound takes the tracks added last, during the submissions of the round only
+	SetSelectionRound SetSelection = "round"
+)
+
+func (s SetSelection) Valid() bool {
+	return s == SetSelectionFirst || s == SetSelectionRecent || s == SetSelectionRound
+}
+
+type RoundStatus string
+
+const (
+	RoundStatusUpcoming RoundStatus = "upcoming"
+	// RoundStatusSubmissions accepts the sets of the round
+	RoundStatusSubmissions RoundStatus = "submissions"
+	// RoundStatusReview is the pause between the deadline and the voting
+	RoundStatusReview RoundStatus = "review"
+	RoundStatusVoting RoundStatus = "voting"
+	RoundStatusClosed RoundStatus = "closed"
+)
+
+// Round is a week of Bangr: users submit their set until SubmissionDeadline,
+// then like the sets of the others from VotingStartsAt until ClosesAt
+type Round struct {
+	ID                 uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4()" json:"id"`
+	CreatedAt          time.Time `json:"-"`
+	UpdatedAt          time.Time `json:"-"`
+	Number             int       `gorm:"not null;uniqueIndex" json:"number"`
+	OpensAt            time.Time `gorm:"not null;uniqueIndex" json:"opens_at"`
+	SubmissionDeadline time.Time `gorm:"not null" json:"submission_deadline"`
+	VotingStartsAt     time.Time `gorm:"not null" json:"voting_starts_at"`
+	ClosesAt           time.Time `gorm:"not null;index" json:"closes_at"`
+	// SetSize is the maximum number of tracks of a set of the round
+	SetSize      int          `gorm:"not null;default:3" json:"set_size"`
+	SetSelection SetSelection `gorm:"not null;default:recent" json:"set_selection"`
+	// ClosedAt is when the results of the round were frozen, likes are locked from then on
+	ClosedAt *time.Time `json:"closed_at"`
+}
+
+func (r *Round) StatusAt(t time.Time) RoundStatus {
+	switch {
+	case t.Before(r.OpensAt):
+		return RoundStatusUpcoming
+	case !t.Before(r.ClosesAt):
+		return RoundStatusClosed
+	case t.Before(r.SubmissionDeadline):
+		return RoundStatusSubmissions
+	case t.Before(r.VotingStartsAt):
+		return RoundStatusReview
+	}
+	return RoundStatusVoting
+}
+
+type RoundQueryParams struct {
+	Limit  int `form:"limit,default=20"`
+	Offset int `form:"offset"`
+}
+
+// RoundSchedule generates the rounds, a single row edited by the admins
+type RoundSchedule struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Weekday and Hour are when rounds open, in Timezone
+	Weekday  time.Weekday `gorm:"not null" json:"weekday"`
+	Hour     int          `gorm:"not null" json:"hour"`
+	Timezone string       `gorm:"not null" json:"timezone"`
+	// LengthDays is the time between the opening and the closing of a round
+	LengthDays int `gorm:"not null" json:"length_days"`
+	// SubmissionHours is the time after the opening during which sets are accepted
+	SubmissionHours int `gorm:"not null" json:"submission_hours"`
+	// SetSize and SetSelection are given to the generated rounds
+	SetSize      int          `gorm:"not null;default:3" json:"set_size"`
+	SetSelection SetSelection `gorm:"not null;default:recent" json:"set_selection"`
+}
+
+// DefaultRoundSchedule opens the rounds on Monday at 1 AM, Paris time, as
+// before rounds were configurable
+func DefaultRoundSchedule() RoundSchedule {
+	return RoundSchedule{
+		ID:              1,
+		Weekday:         time.Monday,
+		Hour:            1,
+		Timezone:        "Europe/Paris",
+		LengthDays:      7,
+		SubmissionHours: 24,
+		SetSize:         DefaultSetSize,
+		SetSelection:    SetSelectionRecent,
+	}
+}
+
+func (s *RoundSchedule) Validate() error {
+	if s.Weekday < time.Sunday || s.Weekday > time.Saturday {
+		return fmt.Errorf("invalid weekday %d", s.Weekday)
+	}
+	if s.Hour < 0 || s.Hour > 23 {
+		return fmt.Errorf("invalid hour %d", s.Hour)
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q", s.Timezone)
+	}
+	if s.LengthDays < 1 {
+		return fmt.Errorf("invalid length of %d days", s.LengthDays)
+	}
+	if s.SubmissionHours < 0 || s.SubmissionHours >= s.LengthDays*24 {
+		return fmt.Errorf("submissions must close before the round does")
+	}
+	if s.SetSize < 1 || s.SetSize > MaxSetSize {
+		return fmt.Errorf("invalid set size %d, expected between 1 and %d", s.SetSize, MaxSetSize)
+	}
+	if !s.SetSelection.Valid() {
+		return fmt.Errorf("invalid set selection %q", s.SetSelection)
+	}
+	return nil
+}
+
+func (s *RoundSchedule) Location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// LastOpening returns the latest scheduled opening at or before t
+func (s *RoundSchedule) LastOpening(t time.Time) time.Time {
+	lt := t.In(s.Location())
+	offset := (int(lt.Weekday()) - int(s.Weekday) + 7) % 7
+	opening := time.Date(lt.Year(), lt.Month(), lt.Day()-offset, s.Hour, 0, 0, 0, lt.Location())
+	if opening.After(t) {
+		opening = opening.AddDate(0, 0, -7)
+	}
+	return opening
+}
+
+// NextOpening returns the first opening after t of the rounds following each
+// other from the last opening
+func (s *RoundSchedule) NextOpening(t time.Time) time.Time {
+	opening := s.LastOpening(t)
+	for !opening.After(t) {
+		opening = opening.AddDate(0, 0, s.LengthDays)
+	}
+	return opening
+}
+
+// RoundOpeningAt returns the round of the schedule opening at opensAt
+func (s *RoundSchedule) RoundOpeningAt(opensAt time.Time) Round {
+	opensAt = opensAt.In(s.Location())
+	deadline := opensAt.Add(time.Duration(s.SubmissionHours) * time.Hour)
+	return Round{
+		OpensAt:            opensAt,
+		SubmissionDeadline: deadline,
+		VotingStartsAt:     deadline,
+		// Adding days keeps the opening hour across daylight saving changes
+		ClosesAt:     opensAt.AddDate(0, 0, s.LengthDays),
+		SetSize:      s.SetSize,
+		SetSelection: s.SetSelection,
+	}
+}
+
+// RoundResult is the outcome of a round, frozen when it closes
+type RoundResult struct {
+	RoundID   uuid.UUID `gorm:"type:uuid;primaryKey"`
+	CreatedAt time.Time
+	// TrackOfTheWeekID and TrackOfTheWeekSetID are the most liked track and
+	// the set it was liked from, nil when no track was liked
+	TrackOfTheWeekID    *uuid.UUID `gorm:"type:uuid"`
+	TrackOfTheWeekSetID *uuid.UUID `gorm:"type:uuid"`
+	// TopCuratorID is the user whose sets received the most likes
+	TopCuratorID *uuid.UUID `gorm:"type:uuid;index"`
+}
+
+// RoundTrackResult is the final rank of a track liked from a set of the round
+type RoundTrackResult struct {
+	RoundID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	TrackID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	SetID   uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	Likes   int       `gorm:"not null"`
+	// Rank is shared by ties, ReachedAt is the last like and breaks them
+	Rank      int       `gorm:"not null"`
+	ReachedAt time.Time `gorm:"not null"`
+}
+
+// RoundCuratorResult is the final rank of a user by the likes their sets received
+type RoundCuratorResult struct {
+	RoundID   uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	Likes     int       `gorm:"not null"`
+	Rank      int       `gorm:"not null"`
+	ReachedAt time.Time `gorm:"not null"`
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("loading %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestRoundScheduleLastOpening(t *testing.T) {
+	paris := mustLoadLocation(t, "Europe/Paris")
+	schedule := DefaultRoundSchedule()
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{"during the week", time.Date(2026, 10, 15, 12, 0, 0, 0, paris), time.Date(2026, 10, 12, 1, 0, 0, 0, paris)},
+		{"at the opening", time.Date(2026, 10, 12, 1, 0, 0, 0, paris), time.Date(2026, 10, 12, 1, 0, 0, 0, paris)},
+		{"just before the opening", time.Date(2026, 10, 12, 0, 59, 0, 0, paris), time.Date(2026, 10, 5, 1, 0, 0, 0, paris)},
+		{"given in UTC", time.Date(2026, 10, 11, 23, 30, 0, 0, time.UTC), time.Date(2026, 10, 12, 1, 0, 0, 0, paris)},
+		{"across daylight saving", time.Date(2026, 10, 26, 12, 0, 0, 0, paris), time.Date(2026, 10, 26, 1, 0, 0, 0, paris)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schedule.LastOpening(tt.t); !got.Equal(tt.want) {
+				t.Errorf("LastOpening(%v) = %v, want %v", tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundScheduleNextOpening(t *testing.T) {
+	paris := mustLoadLocation(t, "Europe/Paris")
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, paris)
+
+	tests := []struct {
+		lengthDays int
+		want       time.Time
+	}{
+		{7, time.Date(2026, 10, 19, 1, 0, 0, 0, paris)},
+		{3, time.Date(2026, 10, 18, 1, 0, 0, 0, paris)},
+		{14, time.Date(2026, 10, 26, 1, 0, 0, 0, paris)},
+		{1, time.Date(2026, 10, 16, 1, 0, 0, 0, paris)},
+	}
+	for _, tt := range tests {
+		schedule := DefaultRoundSchedule()
+		schedule.LengthDays = tt.lengthDays
+		if got := schedule.NextOpening(now); !got.Equal(tt.want) {
+			t.Errorf("NextOpening with %d days = %v, want %v", tt.lengthDays, got, tt.want)
+		}
+	}
+}
+
+func TestRoundScheduleRoundOpeningAt(t *testing.T) {
+	paris := mustLoadLocation(t, "Europe/Paris")
+	schedule := DefaultRoundSchedule()
+	schedule.SetSize = 5
+	schedule.SetSelection = SetSelectionRound
+
+	// The round spans the end of daylight saving time and keeps its opening hour
+	opensAt := time.Date(2026, 10, 19, 1, 0, 0, 0, paris)
+	round := schedule.RoundOpeningAt(opensAt.UTC())
+	if !round.OpensAt.Equal(opensAt) {
+		t.Errorf("got opening %v, want %v", round.OpensAt, opensAt)
+	}
+	if want := opensAt.Add(24 * time.Hour); !round.SubmissionDeadline.Equal(want) || !round.VotingStartsAt.Equal(want) {
+		t.Errorf("got deadline %v and voting %v, want %v", round.SubmissionDeadline, round.VotingStartsAt, want)
+	}
+	if want := time.Date(2026, 10, 26, 1, 0, 0, 0, paris); !round.ClosesAt.Equal(want) {
+		t.Errorf("got closing %v, want %v", round.ClosesAt, want)
+	}
+	if round.SetSize != 5 || round.SetSelection != SetSelectionRound {
+		t.Errorf("got set size %d and selection %q, want the ones of the schedule", round.SetSize, round.SetSelection)
+	}
+}
+
+func TestRoundScheduleValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		edit    func(s *RoundSchedule)
+		wantErr bool
+	}{
+		{"default", func(s *RoundSchedule) {}, false},
+		{"invalid weekday", func(s *RoundSchedule) { s.Weekday = 7 }, true},
+		{"invalid hour", func(s *RoundSchedule) { s.Hour = 24 }, true},
+		{"invalid timezone", func(s *RoundSchedule) { s.Timezone = "Mars/Olympus" }, true},
+		{"no length", func(s *RoundSchedule) { s.LengthDays = 0 }, true},
+		{"submissions as long as the round", func(s *RoundSchedule) { s.SubmissionHours = 7 * 24 }, true},
+		{"negative submissions", func(s *RoundSchedule) { s.SubmissionHours = -1 }, true},
+		{"empty set", func(s *RoundSchedule) { s.SetSize = 0 }, true},
+		{"set too large", func(s *RoundSchedule) { s.SetSize = MaxSetSize + 1 }, true},
+		{"largest set", func(s *RoundSchedule) { s.SetSize = MaxSetSize }, false},
+		{"invalid selection", func(s *RoundSchedule) { s.SetSelection = "random" }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule := DefaultRoundSchedule()
+			tt.edit(&schedule)
+			if err := schedule.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRoundStatusAt(t *testing.T) {
+	opensAt := time.Date(2026, 10, 12, 1, 0, 0, 0, time.UTC)
+	round := Round{
+		OpensAt:            opensAt,
+		SubmissionDeadline: opensAt.Add(24 * time.Hour),
+		VotingStartsAt:     opensAt.Add(48 * time.Hour),
+		ClosesAt:           opensAt.AddDate(0, 0, 7),
+	}
+
+	tests := []struct {
+		t    time.Time
+		want RoundStatus
+	}{
+		{opensAt.Add(-time.Second), RoundStatusUpcoming},
+		{opensAt, RoundStatusSubmissions},
+		{round.SubmissionDeadline, RoundStatusReview},
+		{round.VotingStartsAt, RoundStatusVoting},
+		{round.ClosesAt.Add(-time.Second), RoundStatusVoting},
+		{round.ClosesAt, RoundStatusClosed},
+	}
+	for _, tt := range tests {
+		if got := round.StatusAt(tt.t); got != tt.want {
+			t.Errorf("StatusAt(%v) = %s, want %s", tt.t, got, tt.want)
+		}
+	}
+}
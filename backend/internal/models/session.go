@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a signed in device, kept alive by rotating its refresh token
+type Session struct {
+	ID         uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4()"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	UserAgent  string
+	IP         string
+	LastUsedAt time.Time
+	ExpiresAt  time.Time `gorm:"not null;index"`
+	RevokedAt  *time.Time
+}
+
+// RefreshToken is a single use token of a session, only its hash is stored
+type RefreshToken struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4()"`
+	CreatedAt time.Time
+	SessionID uuid.UUID `gorm:"type:uuid;not null;index"`
+	TokenHash string    `gorm:"not null;uniqueIndex"`
+	UsedAt    *time.Time
+}
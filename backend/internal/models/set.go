@@ -12,10 +12,11 @@ type Set struct {
 	UpdatedAt time.Time `json:"-"`
 	Name      string    `json:"name"`
 	Link      string    `json:"link"`
-	UserID    uuid.UUID `gorm:"not null" json:"-"`
+	UserID    uuid.UUID `gorm:"not null;uniqueIndex:idx_sets_user_round" json:"-"`
 	User      User      `json:"user"`
 	Tracks    []Track   `gorm:"many2many:set_tracks;" json:"tracks"`
-	Dummy     bool      `json:"dummy"`
+	// RoundID is the round the set was submitted to, a user has one set per round
+	RoundID *uuid.UUID `gorm:"type:uuid;index;uniqueIndex:idx_sets_user_round" json:"round_id"`
 }
 
 type Track struct {
@@ -28,15 +29,22 @@ type Track struct {
 	URI       string    `json:"uri"`
 	Likes     []Like    `json:"likes"`
 	ImgURL    string    `json:"imgURL"`
+	// PreviewURL is a 30 seconds extract playable without Spotify Premium
+	PreviewURL string `json:"previewURL"`
 }
 
 type Like struct {
 	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4()" json:"id"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
-	UserID    uuid.UUID `json:"-" gorm:"uniqueIndex:idx_user_track"`
+	UserID    uuid.UUID `json:"-" gorm:"uniqueIndex:idx_user_track_round"`
 	User      User      `json:"user"`
-	TrackID   uuid.UUID `json:"track_id" gorm:"uniqueIndex:idx_user_track"`
+	TrackID   uuid.UUID `json:"track_id" gorm:"uniqueIndex:idx_user_track_round"`
+	// SetID is the set the track was liked from, its owner gets the credit
+	SetID *uuid.UUID `json:"set_id" gorm:"type:uuid;index"`
+	// RoundID is the round the like counts for, a track can be liked again in
+	// a later round
+	RoundID *uuid.UUID `json:"round_id" gorm:"type:uuid;index;uniqueIndex:idx_user_track_round"`
 }
 
 type SetDetails struct {
@@ -44,5 +52,18 @@ type SetDetails struct {
 }
 
 type LikeQueryParams struct {
-	Liked bool `form:"liked"`
+	Liked bool   `form:"liked"`
+	SetID string `form:"set_id"`
+}
+
+type SetQueryParams struct {
+	Limit  int `form:"limit,default=20"`
+	Offset int `form:"offset"`
+}
+
+// TrackLikesQueryParams lists the likes of a track, in a single round when RoundID is set
+type TrackLikesQueryParams struct {
+	RoundID string `form:"round_id"`
+	Limit   int    `form:"limit,default=50"`
+	Offset  int    `form:"offset"`
 }
@@ -3,7 +3,9 @@ package models
 import (
 	"time"
 
+	"github.com/VincentBaron/bangr/backend/internal/encryption"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type SpotifyToken struct {
@@ -11,9 +13,17 @@ type SpotifyToken struct {
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 	UserID       uuid.UUID
-	AccessToken  string    `json:"access_token"`
-	RefreshToken string    `json:"refresh_token"`
+	AccessToken  string    `json:"access_token" gorm:"serializer:encrypted"`
+	RefreshToken string    `json:"refresh_token" gorm:"serializer:encrypted"`
 	Expiry       time.Time `json:"expiry"`
+	// KeyID is the master key the tokens are encrypted with
+	KeyID string `json:"-" gorm:"index"`
+}
+
+// BeforeSave records the key the serializer is about to encrypt the tokens with
+func (t *SpotifyToken) BeforeSave(tx *gorm.DB) error {
+	t.KeyID = encryption.ActiveKeyID()
+	return nil
 }
 
 type TokenResponse struct {
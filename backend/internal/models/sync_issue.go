@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type SyncIssueReason string
+
+const (
+	// SyncIssueEpisode is a podcast episode, only tracks make a set
+	SyncIssueEpisode SyncIssueReason = "episode"
+	// SyncIssueLocalFile is a file of the device of the user, unknown to Spotify
+	SyncIssueLocalFile SyncIssueReason = "local_file"
+	// SyncIssueUnavailable is a track removed from Spotify or not playable in the market of the user
+	SyncIssueUnavailable SyncIssueReason = "unavailable"
+	// SyncIssuePlaylistUnavailable is a Bangr playlist deleted or no longer readable
+	SyncIssuePlaylistUnavailable SyncIssueReason = "playlist_unavailable"
+)
+
+// SyncIssue is an item of the playlist of a user the sync skipped, replaced
+// on every sync of the round so the user can fix their playlist before the deadline
+type SyncIssue struct {
+	ID        uuid.UUID       `gorm:"type:uuid;default:uuid_generate_v4()" json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	UserID    uuid.UUID       `gorm:"type:uuid;not null;index" json:"-"`
+	RoundID   *uuid.UUID      `gorm:"type:uuid;index" json:"round_id"`
+	Reason    SyncIssueReason `gorm:"not null" json:"reason"`
+	// Position is the place of the item in the playlist, from 1
+	Position int    `json:"position,omitempty"`
+	ItemURI  string `json:"item_uri,omitempty"`
+	ItemName string `json:"item_name,omitempty"`
+}
@@ -27,6 +27,31 @@ const (
 	Soul       GenreName = "Soul"
 )
 
+type UserTier string
+
+const (
+	// UserTierFree can submit sets, like tracks and listen to previews
+	UserTierFree UserTier = "free"
+	// UserTierPremium can also play full tracks through the Spotify player
+	UserTierPremium UserTier = "premium"
+)
+
+// TierFromProduct maps the product of a Spotify account to its Bangr tier
+func TierFromProduct(product string) UserTier {
+	if product == "premium" {
+		return UserTierPremium
+	}
+	return UserTierFree
+}
+
+type UserRole string
+
+const (
+	UserRoleUser UserRole = "user"
+	// UserRoleAdmin can access the /admin routes
+	UserRoleAdmin UserRole = "admin"
+)
+
 type User struct {
 	ID                  uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4()"`
 	CreatedAt           time.Time
@@ -35,11 +60,29 @@ type User struct {
 	Password            string `json:"password"`
 	Sets                []Set  `gorm:"foreignKey:UserID"`
 	SpotifyToken        SpotifyToken
-	SpotifyUserID       string  `json:"spotify_user_id"`
-	SpotifyPlaylistLink string  `json:"spotify_playlist_link"`
-	ProfilePicURL       string  `json:"profilePicURL"`
-	Genres              []Genre `gorm:"many2many:user_genres;" json:"genres"`
-	HasPaid             bool    `json:"has_paid" gorm:"default:false"`
+	SpotifyUserID       string     `json:"spotify_user_id"`
+	SpotifyPlaylistLink string     `json:"spotify_playlist_link"`
+	ProfilePicURL       string     `json:"profilePicURL"`
+	Genres              []Genre    `gorm:"many2many:user_genres;" json:"genres"`
+	HasPaid             bool       `json:"has_paid" gorm:"default:false"`
+	Tier                UserTier   `json:"tier" gorm:"not null;default:free"`
+	TierCheckedAt       *time.Time `json:"-"`
+	// NeedsReauth is set once Spotify revoked the grant of the user
+	NeedsReauth bool `json:"needs_reauth" gorm:"not null;default:false"`
+	// DeletionScheduledAt hides the account until it is purged, clearing it restores the account
+	DeletionScheduledAt *time.Time `json:"-" gorm:"index"`
+	Role                UserRole   `json:"role" gorm:"not null;default:user"`
+	// BannedAt locks the user out and hides their sets
+	BannedAt  *time.Time `json:"-" gorm:"index"`
+	BanReason string     `json:"-"`
+	// ShowLikes lists the user among the likers of tracks, hidden likes are only counted
+	ShowLikes bool `json:"show_likes" gorm:"not null;default:true"`
+}
+
+type AdminUserQueryParams struct {
+	Query  string `form:"q"`
+	Limit  int    `form:"limit,default=50"`
+	Offset int    `form:"offset"`
 }
 
 type Genre struct {
@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memorySweepSize is the number of buckets above which the idle ones are dropped
+const memorySweepSize = 10000
+
+type bucket struct {
+	tokens     float64
+	refilledAt time.Time
+	limit      Limit
+}
+
+// MemoryLimiter keeps the buckets in the process, each replica limits on its own
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{buckets: make(map[string]*bucket)}
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= memorySweepSize {
+			l.sweep(now)
+		}
+		b = &bucket{tokens: float64(limit.Requests), refilledAt: now}
+		l.buckets[key] = b
+	}
+
+	var allowed bool
+	var retryAfter time.Duration
+	b.tokens, allowed, retryAfter = limit.take(b.tokens, now.Sub(b.refilledAt))
+	b.refilledAt = now
+	b.limit = limit
+	return allowed, retryAfter, nil
+}
+
+// sweep drops the buckets full again, they behave like missing ones
+func (l *MemoryLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.refilledAt) >= b.limit.Per {
+			delete(l.buckets, key)
+		}
+	}
+}
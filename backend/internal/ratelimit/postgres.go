@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PostgresLimiter keeps the buckets in the rate_limit_buckets table, shared
+// by all replicas
+type PostgresLimiter struct {
+	db *gorm.DB
+}
+
+func NewPostgresLimiter(db *gorm.DB) *PostgresLimiter {
+	return &PostgresLimiter{db: db}
+}
+
+func (l *PostgresLimiter) Allow(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	var allowed bool
+	var retryAfter time.Duration
+	err := l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		b := models.RateLimitBucket{Key: key, Tokens: float64(limit.Requests), RefilledAt: now}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&b).Error; err != nil {
+			return err
+		}
+		// Lock the bucket so concurrent requests consume distinct tokens
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&b, "key = ?", key).Error; err != nil {
+			return err
+		}
+
+		b.Tokens, allowed, retryAfter = limit.take(b.Tokens, now.Sub(b.RefilledAt))
+		b.RefilledAt = now
+		return tx.Save(&b).Error
+	})
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to take token of %s: %w", key, err)
+	}
+	return allowed, retryAfter, nil
+}
+
+// DeleteStale removes the buckets untouched for idle and returns how many were
+// deleted, any limit shorter than idle has refilled them
+func (l *PostgresLimiter) DeleteStale(idle time.Duration) (int64, error) {
+	result := l.db.Where("refilled_at < ?", time.Now().Add(-idle)).Delete(&models.RateLimitBucket{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete stale rate limit buckets: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,57 @@
+// Package ratelimit throttles requests with token buckets, kept in memory for
+// a single instance or in Postgres to share them across replicas.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows bursts of Requests, refilled at Requests per Per. The zero
+// Limit is not enforced.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// ParseLimit reads a limit written as requests/duration, e.g. "10/1m"
+func ParseLimit(s string) (Limit, error) {
+	requests, per, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid limit %q, expected requests/duration", s)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q: bad request count", s)
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q: bad duration", s)
+	}
+	return Limit{Requests: n, Per: d}, nil
+}
+
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Per > 0
+}
+
+// take refills a bucket holding tokens for elapsed and consumes a token from
+// it, it returns the tokens left and how long to wait when none was available
+func (l Limit) take(tokens float64, elapsed time.Duration) (float64, bool, time.Duration) {
+	rate := float64(l.Requests) / l.Per.Seconds()
+	tokens = math.Min(float64(l.Requests), tokens+elapsed.Seconds()*rate)
+	if tokens >= 1 {
+		return tokens - 1, true, 0
+	}
+	return tokens, false, time.Duration((1 - tokens) / rate * float64(time.Second))
+}
+
+// Limiter consumes a token from the bucket of key, returning whether the
+// request is allowed and otherwise how long to wait before retrying
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (bool, time.Duration, error)
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Limit
+		wantErr bool
+	}{
+		{s: "10/1m", want: Limit{Requests: 10, Per: time.Minute}},
+		{s: " 5/30s ", want: Limit{Requests: 5, Per: 30 * time.Second}},
+		{s: "0/1h", want: Limit{Requests: 0, Per: time.Hour}},
+		{s: "10", wantErr: true},
+		{s: "", wantErr: true},
+		{s: "ten/1m", wantErr: true},
+		{s: "-1/1m", wantErr: true},
+		{s: "10/minute", wantErr: true},
+		{s: "10/0s", wantErr: true},
+		{s: "10/-1m", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLimit(%q) got error %v, want error %v", tt.s, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLimit(%q) = %+v, want %+v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestLimitEnabled(t *testing.T) {
+	tests := []struct {
+		limit Limit
+		want  bool
+	}{
+		{Limit{}, false},
+		{Limit{Requests: 0, Per: time.Minute}, false},
+		{Limit{Requests: 10}, false},
+		{Limit{Requests: 10, Per: time.Minute}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.limit.Enabled(); got != tt.want {
+			t.Errorf("%+v enabled = %v, want %v", tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestLimitTake(t *testing.T) {
+	limit := Limit{Requests: 10, Per: time.Minute}
+
+	tests := []struct {
+		name       string
+		tokens     float64
+		elapsed    time.Duration
+		wantTokens float64
+		wantAllow  bool
+		wantRetry  time.Duration
+	}{
+		{"full bucket", 10, 0, 9, true, 0},
+		{"last token", 1, 0, 0, true, 0},
+		{"empty bucket", 0, 0, 0, false, 6 * time.Second},
+		{"partly refilled", 0, 3 * time.Second, 0.5, false, 3 * time.Second},
+		{"refilled a token", 0, 6 * time.Second, 0, true, 0},
+		{"refill capped at the burst", 5, time.Hour, 9, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, allowed, retryAfter := limit.take(tt.tokens, tt.elapsed)
+			if allowed != tt.wantAllow || retryAfter.Round(time.Millisecond) != tt.wantRetry ||
+				tokens < tt.wantTokens-1e-9 || tokens > tt.wantTokens+1e-9 {
+				t.Errorf("take(%v, %v) = %v, %v, %v, want %v, %v, %v",
+					tt.tokens, tt.elapsed, tokens, allowed, retryAfter, tt.wantTokens, tt.wantAllow, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	limiter := NewMemoryLimiter()
+	limit := Limit{Requests: 3, Per: time.Hour}
+
+	for i := 0; i < limit.Requests; i++ {
+		if allowed, _, err := limiter.Allow(context.Background(), "a", limit); err != nil || !allowed {
+			t.Fatalf("request %d got %v, %v, want allowed", i+1, allowed, err)
+		}
+	}
+	allowed, retryAfter, err := limiter.Allow(context.Background(), "a", limit)
+	if err != nil || allowed || retryAfter <= 0 || retryAfter > limit.Per/time.Duration(limit.Requests) {
+		t.Errorf("request over the burst got %v, %v, %v, want a refused request to retry within %v",
+			allowed, retryAfter, err, limit.Per/time.Duration(limit.Requests))
+	}
+	if allowed, _, err := limiter.Allow(context.Background(), "b", limit); err != nil || !allowed {
+		t.Errorf("request of another key got %v, %v, want allowed", allowed, err)
+	}
+}
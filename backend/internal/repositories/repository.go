@@ -1,7 +1,6 @@
 package repositories
 
 import (
-	"github.com/VincentBaron/bangr/backend/internal/models"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -42,29 +41,9 @@ func (r *Repository[T]) Save(entity *T) error {
 	return r.db.Save(entity).Error
 }
 
+// DeleteByID deletes the entity only, the services own the cascade rules of
+// their entities
 func (r *Repository[T]) DeleteByID(id uuid.UUID) error {
-	return r.db.Transaction(func(tx *gorm.DB) error {
-		// Find the user
-		var entity T
-		if err := tx.Where("id = ?", id).First(&entity).Error; err != nil {
-			return err
-		}
-
-		// Delete associated SpotifyToken
-		if err := tx.Where("user_id = ?", id).Delete(&models.SpotifyToken{}).Error; err != nil {
-			return err
-		}
-
-		// Delete associated genres (from the join table)
-		if err := tx.Exec("DELETE FROM user_genres WHERE user_id = ?", id).Error; err != nil {
-			return err
-		}
-
-		// Finally, delete the user
-		if err := tx.Delete(&entity).Error; err != nil {
-			return err
-		}
-
-		return nil
-	})
+	var entity T
+	return r.db.Where("id = ?", id).Delete(&entity).Error
 }
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/config"
+	"github.com/VincentBaron/bangr/backend/internal/dto"
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/repositories"
+	"github.com/VincentBaron/bangr/backend/internal/tokenstore"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/zmb3/spotify/v2"
+	"gorm.io/gorm"
+)
+
+// accountDeletionGrace is how long a deleted account can still be restored
+const accountDeletionGrace = 14 * 24 * time.Hour
+
+var ErrDeletionNotScheduled = errors.New("account deletion is not scheduled")
+
+type AccountService struct {
+	userRepository     *repositories.Repository[models.User]
+	sessionService     *SessionService
+	leaderboardService *LeaderboardService
+	tokenStore         *tokenstore.Store
+}
+
+func NewAccountService(userRepo *repositories.Repository[models.User], sessionService *SessionService, leaderboardService *LeaderboardService, tokenStore *tokenstore.Store) *AccountService {
+	return &AccountService{
+		userRepository:     userRepo,
+		sessionService:     sessionService,
+		leaderboardService: leaderboardService,
+		tokenStore:         tokenStore,
+	}
+}
+
+// ScheduleDeletion hides the account of the current user and signs them out
+// everywhere, it is purged once the grace period ends unless restored
+func (s *AccountService) ScheduleDeletion(c *gin.Context) (*dto.DeleteMeResp, error) {
+	user := c.MustGet("user").(*models.User)
+
+	if user.DeletionScheduledAt == nil {
+		deletionAt := time.Now().Add(accountDeletionGrace)
+		if err := config.DB.Model(user).Update("deletion_scheduled_at", deletionAt).Error; err != nil {
+			log.Println(err)
+			return nil, fmt.Errorf("failed to schedule deletion: %w", err)
+		}
+		user.DeletionScheduledAt = &deletionAt
+	}
+
+	if err := s.sessionService.RevokeAll(user.ID); err != nil {
+		return nil, err
+	}
+
+	return &dto.DeleteMeResp{DeletionScheduledAt: *user.DeletionScheduledAt}, nil
+}
+
+// Restore cancels the scheduled deletion of the current user, who signed in
+// again during the grace period
+func (s *AccountService) Restore(c *gin.Context) error {
+	user := c.MustGet("user").(*models.User)
+	if user.DeletionScheduledAt == nil {
+		return ErrDeletionNotScheduled
+	}
+
+	if err := config.DB.Model(user).Update("deletion_scheduled_at", nil).Error; err != nil {
+		log.Println(err)
+		return fmt.Errorf("failed to restore account: %w", err)
+	}
+	user.DeletionScheduledAt = nil
+	return nil
+}
+
+// PurgeDeleted deletes the accounts whose grace period ended and returns how
+// many were purged. A failing account is logged and retried on the next run.
+func (s *AccountService) PurgeDeleted() (int64, error) {
+	var users []models.User
+	if err := config.DB.Where("deletion_scheduled_at <= ?", time.Now()).Find(&users).Error; err != nil {
+		return 0, fmt.Errorf("failed to find deleted accounts: %w", err)
+	}
+
+	var purged int64
+	for _, user := range users {
+		if err := s.purge(user); err != nil {
+			log.Printf("Couldn't purge user %s: %v", user.ID, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+func (s *AccountService) purge(user models.User) error {
+	// Spotify deletes a playlist by unfollowing it, this is best effort as the
+	// grant may already be revoked
+	if user.SpotifyPlaylistLink != "" {
+		client, err := s.tokenStore.Client(context.Background(), user.ID)
+		if err == nil {
+			err = client.UnfollowPlaylist(context.Background(), spotify.ID(user.SpotifyPlaylistLink))
+		}
+		if err != nil && !errors.Is(err, tokenstore.ErrNotLinked) {
+			log.Printf("Couldn't unfollow playlist of user %s: %v", user.ID, err)
+		}
+	}
+
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		return s.deleteUserData(tx, user.ID)
+	})
+}
+
+// deleteUserData removes the user with everything they own, the likes given
+// to other users are taken off their standings
+func (s *AccountService) deleteUserData(tx *gorm.DB, id uuid.UUID) error {
+	// Take the likes given off the standings of the set owners
+	var given []struct {
+		CreatedAt time.Time
+		OwnerID   uuid.UUID
+	}
+	if err := tx.Raw(`
+		SELECT likes.created_at, sets.user_id AS owner_id
+		FROM likes
+		JOIN sets ON sets.id = likes.set_id
+		WHERE likes.user_id = ? AND sets.user_id <> ?`, id, id).Scan(&given).Error; err != nil {
+		return fmt.Errorf("failed to find likes given: %w", err)
+	}
+	for _, like := range given {
+		if err := s.leaderboardService.ApplyLike(tx, like.OwnerID, like.CreatedAt, -1); err != nil {
+			return err
+		}
+	}
+	if err := tx.Where("user_id = ?", id).Delete(&models.Like{}).Error; err != nil {
+		return fmt.Errorf("failed to delete likes given: %w", err)
+	}
+
+	// Delete the sets, with the likes they received and the tracks no other set holds
+	setIDs := tx.Model(&models.Set{}).Select("id").Where("user_id = ?", id)
+	var trackIDs []uuid.UUID
+	if err := tx.Raw(`
+		SELECT DISTINCT st.track_id
+		FROM set_tracks st
+		JOIN sets s ON s.id = st.set_id
+		WHERE s.user_id = ? AND NOT EXISTS (
+			SELECT 1 FROM set_tracks o
+			JOIN sets os ON os.id = o.set_id
+			WHERE o.track_id = st.track_id AND os.user_id <> ?
+		) AND NOT EXISTS (
+			SELECT 1 FROM house_set_tracks h WHERE h.track_id = st.track_id
+		)`, id, id).Scan(&trackIDs).Error; err != nil {
+		return fmt.Errorf("failed to find tracks: %w", err)
+	}
+	// The frozen results of the closed rounds lose the user and their sets
+	if err := tx.Where("set_id IN (?)", setIDs).Delete(&models.RoundTrackResult{}).Error; err != nil {
+		return fmt.Errorf("failed to delete track results: %w", err)
+	}
+	if err := tx.Where("user_id = ?", id).Delete(&models.RoundCuratorResult{}).Error; err != nil {
+		return fmt.Errorf("failed to delete curator results: %w", err)
+	}
+	if err := tx.Model(&models.RoundResult{}).Where("track_of_the_week_set_id IN (?)", setIDs).
+		Updates(map[string]interface{}{"track_of_the_week_id": nil, "track_of_the_week_set_id": nil}).Error; err != nil {
+		return fmt.Errorf("failed to update round results: %w", err)
+	}
+	if err := tx.Model(&models.RoundResult{}).Where("top_curator_id = ?", id).
+		Update("top_curator_id", nil).Error; err != nil {
+		return fmt.Errorf("failed to update round results: %w", err)
+	}
+
+	if err := tx.Where("set_id IN (?)", setIDs).Delete(&models.Like{}).Error; err != nil {
+		return fmt.Errorf("failed to delete likes received: %w", err)
+	}
+	if err := tx.Exec("DELETE FROM set_tracks WHERE set_id IN (?)", setIDs).Error; err != nil {
+		return fmt.Errorf("failed to delete set tracks: %w", err)
+	}
+	if len(trackIDs) > 0 {
+		if err := tx.Where("track_id IN ?", trackIDs).Delete(&models.Like{}).Error; err != nil {
+			return fmt.Errorf("failed to delete track likes: %w", err)
+		}
+		if err := tx.Where("id IN ?", trackIDs).Delete(&models.Track{}).Error; err != nil {
+			return fmt.Errorf("failed to delete tracks: %w", err)
+		}
+	}
+	if err := tx.Where("user_id = ?", id).Delete(&models.Set{}).Error; err != nil {
+		return fmt.Errorf("failed to delete sets: %w", err)
+	}
+
+	if err := tx.Where("user_id = ?", id).Delete(&models.LeaderboardStanding{}).Error; err != nil {
+		return fmt.Errorf("failed to delete standings: %w", err)
+	}
+
+	// Delete the sessions and pending authorizations
+	sessionIDs := tx.Model(&models.Session{}).Select("id").Where("user_id = ?", id)
+	if err := tx.Where("session_id IN (?)", sessionIDs).Delete(&models.RefreshToken{}).Error; err != nil {
+		return fmt.Errorf("failed to delete refresh tokens: %w", err)
+	}
+	if err := tx.Where("user_id = ?", id).Delete(&models.Session{}).Error; err != nil {
+		return fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	if err := tx.Where("user_id = ?", id).Delete(&models.OAuthState{}).Error; err != nil {
+		return fmt.Errorf("failed to delete OAuth states: %w", err)
+	}
+	if err := tx.Where("user_id = ?", id).Delete(&models.LoginCode{}).Error; err != nil {
+		return fmt.Errorf("failed to delete login codes: %w", err)
+	}
+
+	// Audit events are kept for security reviews, without the identity of the user
+	if err := tx.Model(&models.AuditEvent{}).Where("user_id = ?", id).
+		Updates(map[string]interface{}{"user_id": nil, "username": "", "ip": "", "user_agent": ""}).Error; err != nil {
+		return fmt.Errorf("failed to anonymize audit events: %w", err)
+	}
+
+	if err := tx.Where("user_id = ?", id).Delete(&models.SyncIssue{}).Error; err != nil {
+		return fmt.Errorf("failed to delete sync issues: %w", err)
+	}
+	if err := tx.Where("user_id = ?", id).Delete(&models.DataExport{}).Error; err != nil {
+		return fmt.Errorf("failed to delete data exports: %w", err)
+	}
+
+	if err := tx.Where("user_id = ?", id).Delete(&models.SpotifyToken{}).Error; err != nil {
+		return fmt.Errorf("failed to delete Spotify token: %w", err)
+	}
+	if err := tx.Exec("DELETE FROM user_genres WHERE user_id = ?", id).Error; err != nil {
+		return fmt.Errorf("failed to delete genres: %w", err)
+	}
+
+	if err := tx.Delete(&models.User{}, "id = ?", id).Error; err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/config"
+	"github.com/VincentBaron/bangr/backend/internal/dto"
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUserNotFound  = errors.New("user not found")
+	ErrCannotBanSelf = errors.New("admins cannot ban themselves")
+)
+
+type AdminService struct {
+	userRepository *repositories.Repository[models.User]
+	sessionService *SessionService
+	syncService    *SyncService
+	auditService   *AuditService
+}
+
+func NewAdminService(userRepo *repositories.Repository[models.User], sessionService *SessionService, syncService *SyncService, auditService *AuditService) *AdminService {
+	return &AdminService{
+		userRepository: userRepo,
+		sessionService: sessionService,
+		syncService:    syncService,
+		auditService:   auditService,
+	}
+}
+
+// ListUsers returns a page of the users, filtered by username when a query is set
+func (s *AdminService) ListUsers(params models.AdminUserQueryParams) (*dto.GetAdminUsersResp, error) {
+	query := config.DB.Model(&models.User{})
+	if params.Query != "" {
+		query = query.Where(`username ILIKE ? ESCAPE '\'`, "%"+likeEscaper.Replace(params.Query)+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	var users []models.User
+	if err := query.Order("created_at DESC").Limit(params.Limit).Offset(params.Offset).Find(&users).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to find users: %w", err)
+	}
+
+	resp := dto.GetAdminUsersResp{Users: make([]dto.GetAdminUserResp, 0, len(users)), Total: total}
+	for i := range users {
+		resp.Users = append(resp.Users, adminUserResp(&users[i]))
+	}
+	return &resp, nil
+}
+
+func (s *AdminService) GetUser(id uuid.UUID) (*dto.GetAdminUserResp, error) {
+	user, err := s.findUser(id)
+	if err != nil {
+		return nil, err
+	}
+	resp := adminUserResp(user)
+	return &resp, nil
+}
+
+// Ban locks the user out of every session and hides their sets
+func (s *AdminService) Ban(c *gin.Context, id uuid.UUID, reason string) (*dto.GetAdminUserResp, error) {
+	admin := c.MustGet("user").(*models.User)
+	if admin.ID == id {
+		return nil, ErrCannotBanSelf
+	}
+	user, err := s.findUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := config.DB.Model(user).Updates(map[string]interface{}{"banned_at": now, "ban_reason": reason}).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to ban user: %w", err)
+	}
+	user.BannedAt = &now
+	user.BanReason = reason
+	if err := s.sessionService.RevokeAll(user.ID); err != nil {
+		return nil, err
+	}
+
+	s.auditService.Record(c, models.AuditEventUserBanned, &user.ID, user.Username, fmt.Sprintf("by %s: %s", admin.Username, reason))
+	resp := adminUserResp(user)
+	return &resp, nil
+}
+
+func (s *AdminService) Unban(c *gin.Context, id uuid.UUID) (*dto.GetAdminUserResp, error) {
+	admin := c.MustGet("user").(*models.User)
+	user, err := s.findUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := config.DB.Model(user).Updates(map[string]interface{}{"banned_at": nil, "ban_reason": ""}).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to unban user: %w", err)
+	}
+	user.BannedAt = nil
+	user.BanReason = ""
+
+	s.auditService.Record(c, models.AuditEventUserUnbanned, &user.ID, user.Username, "by "+admin.Username)
+	resp := adminUserResp(user)
+	return &resp, nil
+}
+
+// Resync updates the set of the current round from the playlist of the user,
+// the set is frozen past the submission deadline
+func (s *AdminService) Resync(c *gin.Context, id uuid.UUID) (*models.Set, error) {
+	admin := c.MustGet("user").(*models.User)
+	user, err := s.findUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.syncService.SyncUser(c, user, SyncOptions{})
+	if err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to sync user: %w", err)
+	}
+	if result.Frozen {
+		return nil, ErrSetFrozen
+	}
+
+	if result.Created || len(result.Added) > 0 || len(result.Removed) > 0 {
+		s.auditService.Record(c, models.AuditEventUserResynced, &user.ID, user.Username, "by "+admin.Username)
+	}
+	return result.Set, nil
+}
+
+func (s *AdminService) findUser(id uuid.UUID) (*models.User, error) {
+	user, err := s.userRepository.FindByFilter(map[string]interface{}{"id": id})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+	return user, nil
+}
+
+func adminUserResp(user *models.User) dto.GetAdminUserResp {
+	return dto.GetAdminUserResp{
+		ID:                  user.ID,
+		Username:            user.Username,
+		Role:                user.Role,
+		Tier:                user.Tier,
+		CreatedAt:           user.CreatedAt,
+		SpotifyLinked:       user.SpotifyUserID != "",
+		NeedsReauth:         user.NeedsReauth,
+		BannedAt:            user.BannedAt,
+		BanReason:           user.BanReason,
+		DeletionScheduledAt: user.DeletionScheduledAt,
+	}
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern, matched with ESCAPE '\'
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
@@ -0,0 +1,21 @@
+package services
+
+import "testing"
+
+func TestLikeEscaper(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"vincent", "vincent"},
+		{"100%", `100\%`},
+		{"a_b", `a\_b`},
+		{`back\slash`, `back\\slash`},
+		{`%_\`, `\%\_\\`},
+	}
+	for _, tt := range tests {
+		if got := likeEscaper.Replace(tt.query); got != tt.want {
+			t.Errorf("likeEscaper.Replace(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"log"
+
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type AuditService struct {
+	auditEventRepository *repositories.Repository[models.AuditEvent]
+}
+
+func NewAuditService(auditEventRepo *repositories.Repository[models.AuditEvent]) *AuditService {
+	return &AuditService{
+		auditEventRepository: auditEventRepo,
+	}
+}
+
+// Record saves an event of the request, failures are only logged so that
+// auditing never blocks the action itself
+func (s *AuditService) Record(c *gin.Context, eventType models.AuditEventType, userID *uuid.UUID, username, details string) {
+	event := models.AuditEvent{
+		Type:      eventType,
+		UserID:    userID,
+		Username:  username,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Details:   details,
+	}
+	if err := s.auditEventRepository.Save(&event); err != nil {
+		log.Printf("Couldn't record %s audit event: %v", eventType, err)
+	}
+}
@@ -2,12 +2,12 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"math/rand"
+	"net/url"
 	"os"
-	"strconv"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/VincentBaron/bangr/backend/internal/config"
@@ -20,49 +20,66 @@ import (
 	"github.com/zmb3/spotify/v2"
 	spotifyauth "github.com/zmb3/spotify/v2/auth"
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
 )
 
+// AccessTokenTTL is the lifetime of the JWTs, sessions outlive them through refresh tokens
+const AccessTokenTTL = 15 * time.Minute
+
 type AuthService struct {
-	userRepository  *repositories.Repository[models.User]
-	genreRepository *repositories.Repository[models.Genre]
+	userRepository    *repositories.Repository[models.User]
+	genreRepository   *repositories.Repository[models.Genre]
+	oauthStateService *OAuthStateService
+	sessionService    *SessionService
+	loginGuardService *LoginGuardService
 }
 
-func NewAuthService(userRepo *repositories.Repository[models.User], genreRepo *repositories.Repository[models.Genre]) *AuthService {
+func NewAuthService(userRepo *repositories.Repository[models.User], genreRepo *repositories.Repository[models.Genre], oauthStateService *OAuthStateService, sessionService *SessionService, loginGuardService *LoginGuardService) *AuthService {
 	return &AuthService{
-		userRepository:  userRepo,
-		genreRepository: genreRepo,
+		userRepository:    userRepo,
+		genreRepository:   genreRepo,
+		oauthStateService: oauthStateService,
+		sessionService:    sessionService,
+		loginGuardService: loginGuardService,
 	}
 }
 
-// In-memory map to store state to userID mapping
-var stateToUserIDMap = struct {
-	sync.RWMutex
-	m map[string]uuid.UUID
-}{m: make(map[string]uuid.UUID)}
+// passwordCost is the bcrypt cost of the passwords
+const passwordCost = 10
+
+// dummyPasswordHash is compared against when the user has no password, so
+// that the response time doesn't tell which usernames exist
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("bangr-dummy-password"), passwordCost)
+
+var (
+	ErrSpotifyAlreadyLinked = errors.New("Spotify account already linked to another user")
+	ErrPasswordRequired     = errors.New("a password is required to unlink Spotify")
+	ErrSpotifyAccountChange = errors.New("relink with the Spotify account previously linked")
+	ErrInvalidCredentials   = errors.New("invalid username or password")
+	ErrAccountBanned        = errors.New("account banned")
+	// ErrDeletionScheduled is returned for the routes closed to the accounts
+	// scheduled for deletion, which can only be restored or exported
+	ErrDeletionScheduled = errors.New("account scheduled for deletion")
+)
 
-func (s *AuthService) CallbackService(c *gin.Context) error {
+// CallbackService completes the Spotify authorization and returns the frontend
+// URL the user is redirected to
+func (s *AuthService) CallbackService(c *gin.Context) (string, error) {
 	state := c.Query("state")
 
-	// Retrieve the userID using the state
-	stateToUserIDMap.RLock()
-	userID, exists := stateToUserIDMap.m[state]
-	stateToUserIDMap.RUnlock()
-	if !exists {
-		log.Println("Invalid state parameter")
-		return fmt.Errorf("invalid state parameter")
+	// Retrieve the pending authorization using the state
+	oauthState, err := s.oauthStateService.Consume(state)
+	if err != nil {
+		log.Println(err)
+		return "", err
 	}
 
-	// Create a new authenticator
-	auth := spotifyauth.New(
-		spotifyauth.WithRedirectURL(config.Conf.SpotifyRedirectURL),
-		spotifyauth.WithScopes(spotifyauth.ScopeUserReadPrivate),
-		spotifyauth.WithClientID(config.Conf.SpotifyClientID),
-		spotifyauth.WithClientSecret(config.Conf.SpotifyClientSecret),
-	)
-	token, err := auth.Token(c, state, c.Request)
+	// Exchange the code with the verifier stored along the state
+	token, err := newSpotifyAuthenticator().Token(c, state, c.Request, oauth2.VerifierOption(oauthState.CodeVerifier))
 	if err != nil {
 		log.Println(err)
-		return fmt.Errorf("failed to get token: %w", err)
+		return "", fmt.Errorf("failed to get token: %w", err)
 	}
 
 	// Use the token to get the Spotify user
@@ -71,53 +88,218 @@ func (s *AuthService) CallbackService(c *gin.Context) error {
 	spotifyUser, err := client.CurrentUser(c)
 	if err != nil {
 		log.Println(err)
-		return fmt.Errorf("failed to get current user: %w", err)
+		return "", fmt.Errorf("failed to get current user: %w", err)
 	}
 
-	// Check if user has Spotify Premium
-	if spotifyUser.Product != "premium" {
-		// Delete the user created during signup
-		err := s.userRepository.DeleteByID(userID)
+	var user *models.User
+	switch oauthState.Purpose {
+	case models.OAuthPurposeLogin:
+		user, err = s.findOrCreateSpotifyUser(spotifyUser)
 		if err != nil {
-			log.Println("Failed to delete user created during signup:", err)
-			return fmt.Errorf("Spotify Premium required, and failed to delete created user: %w", err)
+			return "", err
+		}
+	default:
+		user, err = s.userRepository.FindByFilter(map[string]interface{}{"id": *oauthState.UserID}, "SpotifyToken")
+		if err != nil {
+			log.Println(err)
+			return "", fmt.Errorf("failed to find user: %w", err)
 		}
-		return fmt.Errorf("Spotify Premium subscription required")
-	}
 
-	// Update the user record with the Spotify details
-	user, err := s.userRepository.FindByFilter(map[string]interface{}{"id": userID})
-	if err != nil {
-		log.Println(err)
-		return fmt.Errorf("failed to find user: %w", err)
+		// A Spotify account can only sign in a single user
+		var linked int64
+		if err := config.DB.Model(&models.User{}).
+			Where("spotify_user_id = ? AND id <> ?", spotifyUser.ID, user.ID).
+			Count(&linked).Error; err != nil {
+			log.Println(err)
+			return "", fmt.Errorf("failed to check linked accounts: %w", err)
+		}
+		if linked > 0 {
+			return "", ErrSpotifyAlreadyLinked
+		}
+		if oauthState.Purpose == models.OAuthPurposeRelink && user.SpotifyUserID != "" && user.SpotifyUserID != spotifyUser.ID {
+			return "", ErrSpotifyAccountChange
+		}
 	}
 
-	playlist, err := client.CreatePlaylistForUser(context.Background(), spotifyUser.ID, user.Username+"'s Bangr", "Add your favorite song every 3 days to listen to other people's favorite songs!", false, false)
-	if err != nil {
-		log.Println(err)
-		return fmt.Errorf("failed to create playlist: %w", err)
+	// Update the user record with the Spotify details, relinking only renews the token
+	if oauthState.Purpose != models.OAuthPurposeRelink && (user.SpotifyPlaylistLink == "" || user.SpotifyUserID != spotifyUser.ID) {
+		playlist, err := client.CreatePlaylistForUser(context.Background(), spotifyUser.ID, user.Username+"'s Bangr", "Add your favorite song every 3 days to listen to other people's favorite songs!", false, false)
+		if err != nil {
+			log.Println(err)
+			return "", fmt.Errorf("failed to create playlist: %w", err)
+		}
+		user.SpotifyPlaylistLink = playlist.ID.String()
 	}
 
 	user.SpotifyToken.AccessToken = token.AccessToken
 	user.SpotifyToken.RefreshToken = token.RefreshToken
 	user.SpotifyToken.Expiry = token.Expiry
 	user.SpotifyUserID = spotifyUser.ID
-	user.SpotifyPlaylistLink = playlist.ID.String()
+	user.NeedsReauth = false
+	now := time.Now()
+	user.Tier = models.TierFromProduct(spotifyUser.Product)
+	user.TierCheckedAt = &now
 	if len(spotifyUser.Images) > 0 {
 		user.ProfilePicURL = spotifyUser.Images[0].URL
 	}
 
+	if err := saveSpotifyLink(config.DB, user); err != nil {
+		log.Println(err)
+		return "", fmt.Errorf("failed to save user: %w", err)
+	}
+
+	redirectURL := os.Getenv("FRONTEND_URL")
+	if oauthState.Purpose == models.OAuthPurposeLogin {
+		// Hand a single use code to the frontend rather than the tokens themselves
+		code, err := s.oauthStateService.CreateLoginCode(user.ID)
+		if err != nil {
+			return "", err
+		}
+		redirectURL += "?login_code=" + url.QueryEscape(code)
+	}
+
+	return redirectURL, nil
+}
+
+// saveSpotifyLink saves the user along with their Spotify token. Saving the
+// user alone only upserts the foreign key of a token already saved, dropping
+// the renewed tokens.
+func saveSpotifyLink(db *gorm.DB, user *models.User) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("SpotifyToken").Save(user).Error; err != nil {
+			return err
+		}
+		user.SpotifyToken.UserID = user.ID
+		return tx.Save(&user.SpotifyToken).Error
+	})
+}
+
+// findOrCreateSpotifyUser returns the user owning the Spotify account, creating
+// a passwordless one on first sign in
+func (s *AuthService) findOrCreateSpotifyUser(spotifyUser *spotify.PrivateUser) (*models.User, error) {
+	user, err := s.userRepository.FindByFilter(map[string]interface{}{"spotify_user_id": spotifyUser.ID}, "SpotifyToken")
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+
+	username, err := s.uniqueUsername(spotifyUser.DisplayName, spotifyUser.ID)
+	if err != nil {
+		return nil, err
+	}
+	user = &models.User{Username: username}
 	if err := s.userRepository.Save(user); err != nil {
 		log.Println(err)
-		return fmt.Errorf("failed to save user: %w", err)
+		return nil, fmt.Errorf("failed to save user: %w", err)
+	}
+	return user, nil
+}
+
+// uniqueUsername derives a free username from the Spotify display name
+func (s *AuthService) uniqueUsername(displayName string, spotifyUserID string) (string, error) {
+	base := strings.Join(strings.Fields(displayName), "")
+	if base == "" {
+		base = spotifyUserID
+	}
+
+	username := base
+	for i := 0; i < 10; i++ {
+		var count int64
+		if err := config.DB.Model(&models.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+			log.Println(err)
+			return "", fmt.Errorf("failed to check username: %w", err)
+		}
+		if count == 0 {
+			return username, nil
+		}
+		suffix, err := randomToken(3)
+		if err != nil {
+			return "", err
+		}
+		username = base + "-" + suffix
 	}
+	return "", fmt.Errorf("failed to find a free username")
+}
 
-	return nil
+// SpotifyLogin starts a passwordless sign in with Spotify
+func (s *AuthService) SpotifyLogin(c *gin.Context) (*string, error) {
+	oauthState, err := s.oauthStateService.Create(models.OAuthPurposeLogin, nil)
+	if err != nil {
+		return nil, err
+	}
+	authURL := newSpotifyAuthenticator().AuthURL(oauthState.State, oauth2.S256ChallengeOption(oauthState.CodeVerifier))
+	return &authURL, nil
+}
+
+// ExchangeLoginCode opens a session for the user who signed in with Spotify
+func (s *AuthService) ExchangeLoginCode(c *gin.Context, code string) (*dto.AuthTokensResp, error) {
+	userID, err := s.oauthStateService.ConsumeLoginCode(code)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepository.FindByFilter(map[string]interface{}{"id": userID}, "SpotifyToken")
+	if err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+	if user.BannedAt != nil {
+		return nil, ErrAccountBanned
+	}
+
+	session, refreshToken, err := s.sessionService.Create(c, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return s.issueTokens(c, user, session, refreshToken)
+}
+
+// LinkSpotify starts the authorization attaching a Spotify account to the current user
+func (s *AuthService) LinkSpotify(c *gin.Context) (*string, error) {
+	return s.authorizeCurrentUser(c, models.OAuthPurposeLink)
+}
+
+// RelinkSpotify starts a new authorization for the current user whose grant
+// was revoked, the callback only renews their token
+func (s *AuthService) RelinkSpotify(c *gin.Context) (*string, error) {
+	return s.authorizeCurrentUser(c, models.OAuthPurposeRelink)
+}
+
+func (s *AuthService) authorizeCurrentUser(c *gin.Context, purpose models.OAuthPurpose) (*string, error) {
+	user := c.MustGet("user").(*models.User)
+	oauthState, err := s.oauthStateService.Create(purpose, &user.ID)
+	if err != nil {
+		return nil, err
+	}
+	authURL := newSpotifyAuthenticator().AuthURL(oauthState.State, oauth2.S256ChallengeOption(oauthState.CodeVerifier))
+	return &authURL, nil
+}
+
+// UnlinkSpotify detaches the Spotify account of the current user, who must be
+// able to sign in with a password afterwards
+func (s *AuthService) UnlinkSpotify(c *gin.Context) error {
+	user := c.MustGet("user").(*models.User)
+	if user.Password == "" {
+		return ErrPasswordRequired
+	}
+
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.SpotifyToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"spotify_user_id":       "",
+			"spotify_playlist_link": "",
+		}).Error
+	})
 }
 
 func (s *AuthService) Signup(c *gin.Context, payload *dto.PostUserReq) (*string, error) {
 	// Hash the password
-	hash, err := bcrypt.GenerateFromPassword([]byte(payload.Password), 10)
+	hash, err := bcrypt.GenerateFromPassword([]byte(payload.Password), passwordCost)
 	if err != nil {
 		log.Println(err)
 		return nil, fmt.Errorf("failed to hash password: %w", err)
@@ -154,68 +336,166 @@ func (s *AuthService) Signup(c *gin.Context, payload *dto.PostUserReq) (*string,
 		return nil, fmt.Errorf("failed to associate genres with user: %w", err)
 	}
 
-	// Generate a unique state
-	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
-	state := strconv.FormatUint(rng.Uint64(), 10)
-
-	// Store the state to userID mapping
-	stateToUserIDMap.Lock()
-	stateToUserIDMap.m[state] = user.ID
-	stateToUserIDMap.Unlock()
+	// Generate a unique state for the user
+	oauthState, err := s.oauthStateService.Create(models.OAuthPurposeSignup, &user.ID)
+	if err != nil {
+		return nil, err
+	}
 
 	// Redirect the user to the Spotify authorization page
-	url := "https://accounts.spotify.com/authorize?response_type=code" +
-		"&client_id=" + config.Conf.SpotifyClientID +
-		"&scope=" + config.Conf.SpotifyScopes +
-		"&redirect_uri=" + config.Conf.SpotifyRedirectURL +
-		"&state=" + state
+	authURL := newSpotifyAuthenticator().AuthURL(oauthState.State, oauth2.S256ChallengeOption(oauthState.CodeVerifier))
 
-	return &url, nil
+	return &authURL, nil
 }
 
-func (s *AuthService) Login(c *gin.Context, username, password string) error {
+func (s *AuthService) Login(c *gin.Context, username, password string) (*dto.AuthTokensResp, error) {
+	// Refuse locked out usernames before spending time on bcrypt
+	if err := s.loginGuardService.Check(username); err != nil {
+		return nil, err
+	}
+
 	// Look up for requested user
 	var user *models.User
 
 	user, err := s.userRepository.FindByFilter(map[string]interface{}{"username": username}, "SpotifyToken")
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Println("User not found")
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		s.loginGuardService.Fail(c, username, nil)
+		return nil, ErrInvalidCredentials
+	}
 	if err != nil {
 		log.Println(err)
-		return fmt.Errorf("failed to find user: %w", err)
+		return nil, fmt.Errorf("failed to find user: %w", err)
 	}
 
-	if user.ID == uuid.Nil {
-		log.Println("User not found")
-		return fmt.Errorf("user not found")
+	// Compare sent in password with saved users password, users signed up
+	// with Spotify only take as long
+	if user.Password == "" {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		err = bcrypt.ErrMismatchedHashAndPassword
+	} else {
+		err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	}
-
-	// Compare sent in password with saved users password
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if err != nil {
 		log.Println("Password incorrect")
-		return fmt.Errorf("password incorrect")
+		s.loginGuardService.Fail(c, username, &user.ID)
+		return nil, ErrInvalidCredentials
+	}
+	s.loginGuardService.Succeed(c, username, user.ID)
+	if user.BannedAt != nil {
+		return nil, ErrAccountBanned
+	}
+
+	// Open a session for this device
+	session, refreshToken, err := s.sessionService.Create(c, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(c, user, session, refreshToken)
+}
+
+// Refresh rotates the refresh token and issues a new access token for its session
+func (s *AuthService) Refresh(c *gin.Context, refreshToken string) (*dto.AuthTokensResp, error) {
+	session, newRefreshToken, err := s.sessionService.Rotate(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepository.FindByFilter(map[string]interface{}{"id": session.UserID}, "SpotifyToken")
+	if err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+
+	return s.issueTokens(c, user, session, newRefreshToken)
+}
+
+// Logout revokes the session the request was authenticated with
+func (s *AuthService) Logout(c *gin.Context) error {
+	user := c.MustGet("user").(*models.User)
+	session := c.MustGet("session").(*models.Session)
+	return s.sessionService.Revoke(user.ID, session.ID)
+}
+
+// LogoutAll revokes every session of the current user
+func (s *AuthService) LogoutAll(c *gin.Context) error {
+	user := c.MustGet("user").(*models.User)
+	return s.sessionService.RevokeAll(user.ID)
+}
+
+func (s *AuthService) GetSessions(c *gin.Context) ([]dto.GetSessionResp, error) {
+	user := c.MustGet("user").(*models.User)
+	current := c.MustGet("session").(*models.Session)
+
+	sessions, err := s.sessionService.List(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionsResp := make([]dto.GetSessionResp, 0, len(sessions))
+	for _, session := range sessions {
+		sessionsResp = append(sessionsResp, dto.GetSessionResp{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			Current:    session.ID == current.ID,
+		})
 	}
+	return sessionsResp, nil
+}
+
+func (s *AuthService) RevokeSession(c *gin.Context, sessionID uuid.UUID) error {
+	user := c.MustGet("user").(*models.User)
+	return s.sessionService.Revoke(user.ID, sessionID)
+}
 
+// issueTokens signs a short lived access token for the session and returns it
+// along with the refresh token
+func (s *AuthService) issueTokens(c *gin.Context, user *models.User, session *models.Session, refreshToken string) (*dto.AuthTokensResp, error) {
 	// Generate a JWT token
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"sub": user.ID,
-		"exp": time.Now().Add(time.Hour * 24 * 30).Unix(),
+		"sid": session.ID,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(AccessTokenTTL).Unix(),
 	})
 
 	// Sign and get the complete encoded token as a string using the secret
 	tokenString, err := token.SignedString([]byte(os.Getenv("SECRET")))
-
 	if err != nil {
 		log.Println(err)
-		return fmt.Errorf("failed to sign token: %w", err)
+		return nil, fmt.Errorf("failed to sign token: %w", err)
 	}
 
-	SetTokens(c, tokenString, user.SpotifyToken.AccessToken, user.ID.String())
-	return nil
+	SetTokens(c, tokenString, user.ID.String())
+	return &dto.AuthTokensResp{
+		AccessToken:  tokenString,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// newSpotifyAuthenticator returns the authenticator of the Bangr Spotify app
+func newSpotifyAuthenticator() *spotifyauth.Authenticator {
+	// Scopes may be configured space separated or already URL encoded
+	scopes, err := url.QueryUnescape(config.Conf.SpotifyScopes)
+	if err != nil {
+		scopes = config.Conf.SpotifyScopes
+	}
+	return spotifyauth.New(
+		spotifyauth.WithRedirectURL(config.Conf.SpotifyRedirectURL),
+		spotifyauth.WithScopes(strings.Fields(scopes)...),
+		spotifyauth.WithClientID(config.Conf.SpotifyClientID),
+		spotifyauth.WithClientSecret(config.Conf.SpotifyClientSecret),
+	)
 }
 
-func SetTokens(c *gin.Context, tokenString string, spotifyToken string, userID string) {
+func SetTokens(c *gin.Context, tokenString string, userID string) {
 	// Add tokens to the response headers
 	c.Header("Authorization", tokenString)
-	c.Header("SpotifyAuthorization", spotifyToken)
 	c.Header("UserID", userID)
 }
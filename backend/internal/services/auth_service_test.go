@@ -0,0 +1,61 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/models"
+)
+
+func TestSaveSpotifyLinkRenewsToken(t *testing.T) {
+	db := testDB(t)
+
+	user := models.User{
+		Username:    "relinked",
+		NeedsReauth: true,
+		SpotifyToken: models.SpotifyToken{
+			AccessToken:  "revoked-access",
+			RefreshToken: "revoked-refresh",
+			Expiry:       time.Now().Add(-time.Hour),
+		},
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	// Relinking loads the user with the token saved before
+	var relinked models.User
+	if err := db.Preload("SpotifyToken").First(&relinked, "id = ?", user.ID).Error; err != nil {
+		t.Fatalf("loading user: %v", err)
+	}
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	relinked.SpotifyToken.AccessToken = "renewed-access"
+	relinked.SpotifyToken.RefreshToken = "renewed-refresh"
+	relinked.SpotifyToken.Expiry = expiry
+	relinked.NeedsReauth = false
+	if err := saveSpotifyLink(db, &relinked); err != nil {
+		t.Fatalf("saving link: %v", err)
+	}
+
+	var tokens []models.SpotifyToken
+	if err := db.Where("user_id = ?", user.ID).Find(&tokens).Error; err != nil {
+		t.Fatalf("loading tokens: %v", err)
+	}
+	if len(tokens) != 1 {
+		t.Fatalf("got %d tokens, want 1", len(tokens))
+	}
+	if tokens[0].AccessToken != "renewed-access" || tokens[0].RefreshToken != "renewed-refresh" {
+		t.Errorf("got tokens %q and %q, want the renewed ones", tokens[0].AccessToken, tokens[0].RefreshToken)
+	}
+	if !tokens[0].Expiry.Equal(expiry) {
+		t.Errorf("got expiry %v, want %v", tokens[0].Expiry, expiry)
+	}
+
+	var saved models.User
+	if err := db.First(&saved, "id = ?", user.ID).Error; err != nil {
+		t.Fatalf("loading user: %v", err)
+	}
+	if saved.NeedsReauth {
+		t.Error("needs_reauth is still set")
+	}
+}
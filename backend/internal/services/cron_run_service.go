@@ -0,0 +1,82 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/config"
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/repositories"
+)
+
+// JobReport counts the users a job went through
+type JobReport struct {
+	Processed int
+	Skipped   int
+	Errored   int
+}
+
+func (r *JobReport) Add(other *JobReport) {
+	r.Processed += other.Processed
+	r.Skipped += other.Skipped
+	r.Errored += other.Errored
+}
+
+func (r *JobReport) String() string {
+	return fmt.Sprintf("%d users processed, %d skipped, %d errored", r.Processed, r.Skipped, r.Errored)
+}
+
+// Err returns an error when the job failed for some of the users
+func (r *JobReport) Err() error {
+	if r.Errored == 0 {
+		return nil
+	}
+	return fmt.Errorf("failed for %d of %d users", r.Errored, r.Processed+r.Skipped+r.Errored)
+}
+
+type CronRunService struct {
+	cronRunRepository *repositories.Repository[models.CronRun]
+}
+
+func NewCronRunService(cronRunRepo *repositories.Repository[models.CronRun]) *CronRunService {
+	return &CronRunService{
+		cronRunRepository: cronRunRepo,
+	}
+}
+
+// Track runs the job and records its execution, the error of the job is returned
+func (s *CronRunService) Track(job string, fn func() error) error {
+	run := models.CronRun{Job: job, StartedAt: time.Now(), Status: models.CronRunStatusRunning}
+	if err := s.cronRunRepository.Save(&run); err != nil {
+		log.Printf("Couldn't record run of %s: %v", job, err)
+	}
+
+	jobErr := fn()
+
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.Status = models.CronRunStatusSucceeded
+	if jobErr != nil {
+		run.Status = models.CronRunStatusFailed
+		run.Error = jobErr.Error()
+	}
+	if err := s.cronRunRepository.Save(&run); err != nil {
+		log.Printf("Couldn't record run of %s: %v", job, err)
+	}
+	return jobErr
+}
+
+// List returns the latest runs, of a single job when set
+func (s *CronRunService) List(params models.CronRunQueryParams) ([]models.CronRun, error) {
+	query := config.DB.Order("started_at DESC").Limit(params.Limit)
+	if params.Job != "" {
+		query = query.Where("job = ?", params.Job)
+	}
+	runs := make([]models.CronRun, 0)
+	if err := query.Find(&runs).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to find cron runs: %w", err)
+	}
+	return runs, nil
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"encoding/base64"
+	"os"
+	"testing"
+
+	"github.com/VincentBaron/bangr/backend/internal/config"
+	"github.com/VincentBaron/bangr/backend/internal/encryption"
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDB points config.DB to a transaction of the database of
+// TEST_DATABASE_URL, rolled back once the test ends. The tests needing a
+// database are skipped without it.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connecting to the test database: %v", err)
+	}
+	if err := db.Exec(`CREATE EXTENSION IF NOT EXISTS "uuid-ossp"`).Error; err != nil {
+		t.Fatalf("creating the uuid extension: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Set{}, &models.SpotifyToken{}, &models.Track{}, &models.Like{}, &models.Genre{}, &models.LeaderboardStanding{}, &models.HouseSet{}, &models.Round{}, &models.RoundSchedule{}, &models.RoundResult{}, &models.RoundTrackResult{}, &models.RoundCuratorResult{}); err != nil {
+		t.Fatalf("migrating the test database: %v", err)
+	}
+
+	key := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	if err := encryption.LoadKeys("test:"+key, "test"); err != nil {
+		t.Fatalf("loading the encryption keys: %v", err)
+	}
+
+	tx := db.Begin()
+	previous := config.DB
+	config.DB = tx
+	t.Cleanup(func() {
+		tx.Rollback()
+		config.DB = previous
+	})
+	return tx
+}
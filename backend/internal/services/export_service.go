@@ -0,0 +1,370 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/config"
+	"github.com/VincentBaron/bangr/backend/internal/dto"
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// exportSyncLimit is the number of set tracks and likes above which the
+// archive is built by the cron job instead of during the request
+const exportSyncLimit = 2000
+
+// exportRetention is how long a built archive can be downloaded
+const exportRetention = 7 * 24 * time.Hour
+
+var ErrExportNotFound = errors.New("export not found")
+
+type ExportService struct {
+	userRepository       *repositories.Repository[models.User]
+	setRepository        *repositories.Repository[models.Set]
+	dataExportRepository *repositories.Repository[models.DataExport]
+}
+
+func NewExportService(userRepo *repositories.Repository[models.User], setRepo *repositories.Repository[models.Set], dataExportRepo *repositories.Repository[models.DataExport]) *ExportService {
+	return &ExportService{
+		userRepository:       userRepo,
+		setRepository:        setRepo,
+		dataExportRepository: dataExportRepo,
+	}
+}
+
+// Export returns the archive of the current user when it is small enough,
+// otherwise it queues an export for the cron job and returns its status
+func (s *ExportService) Export(c *gin.Context) ([]byte, *dto.GetDataExportResp, error) {
+	user := c.MustGet("user").(*models.User)
+
+	var rows int64
+	if err := config.DB.Raw(`
+		SELECT
+			(SELECT COUNT(*) FROM set_tracks JOIN sets ON sets.id = set_tracks.set_id WHERE sets.user_id = @id) +
+			(SELECT COUNT(*) FROM likes WHERE likes.user_id = @id) +
+			(SELECT COUNT(*) FROM likes JOIN sets ON sets.id = likes.set_id WHERE sets.user_id = @id)`,
+		map[string]interface{}{"id": user.ID}).Scan(&rows).Error; err != nil {
+		log.Println(err)
+		return nil, nil, fmt.Errorf("failed to size export: %w", err)
+	}
+
+	if rows <= exportSyncLimit {
+		archive, err := s.buildArchive(user.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return archive, nil, nil
+	}
+
+	// Queue the export once, asking again returns the pending one or the
+	// archive built until it expires
+	var export models.DataExport
+	err := config.DB.Where("user_id = ? AND status IN ?", user.ID, []models.DataExportStatus{models.DataExportStatusPending, models.DataExportStatusReady}).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("created_at DESC").First(&export).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		export = models.DataExport{UserID: user.ID, Status: models.DataExportStatusPending}
+		err = s.dataExportRepository.Save(&export)
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, nil, fmt.Errorf("failed to queue export: %w", err)
+	}
+	if export.Status == models.DataExportStatusReady {
+		return export.Archive, dataExportResp(&export), nil
+	}
+	return nil, dataExportResp(&export), nil
+}
+
+// GetExport returns the archive of an export of the current user once ready,
+// and its status until then
+func (s *ExportService) GetExport(c *gin.Context, id uuid.UUID) ([]byte, *dto.GetDataExportResp, error) {
+	user := c.MustGet("user").(*models.User)
+
+	export, err := s.dataExportRepository.FindByFilter(map[string]interface{}{"id": id, "user_id": user.ID})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrExportNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, nil, fmt.Errorf("failed to find export: %w", err)
+	}
+	if export.ExpiresAt != nil && export.ExpiresAt.Before(time.Now()) {
+		return nil, nil, ErrExportNotFound
+	}
+
+	if export.Status == models.DataExportStatusReady {
+		return export.Archive, dataExportResp(export), nil
+	}
+	return nil, dataExportResp(export), nil
+}
+
+// ProcessPending builds the archives of the queued exports and returns how
+// many were processed
+func (s *ExportService) ProcessPending() (int64, error) {
+	var processed int64
+	for {
+		claimed, err := s.processNext()
+		if err != nil {
+			return processed, err
+		}
+		if !claimed {
+			return processed, nil
+		}
+		processed++
+	}
+}
+
+// processNext builds the oldest pending export, locked until it is saved so
+// that overlapping runs skip it. It returns false once none is left.
+func (s *ExportService) processNext() (bool, error) {
+	claimed := false
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var export models.DataExport
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ?", models.DataExportStatusPending).
+			Order("created_at").First(&export).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to find pending exports: %w", err)
+		}
+		claimed = true
+
+		now := time.Now()
+		expiresAt := now.Add(exportRetention)
+		export.CompletedAt = &now
+		export.ExpiresAt = &expiresAt
+
+		archive, err := s.buildArchive(export.UserID)
+		if err != nil {
+			log.Printf("Couldn't build export %s: %v", export.ID, err)
+			export.Status = models.DataExportStatusFailed
+			export.Error = err.Error()
+		} else {
+			export.Status = models.DataExportStatusReady
+			export.Archive = archive
+		}
+		if err := tx.Save(&export).Error; err != nil {
+			return fmt.Errorf("failed to save export %s: %w", export.ID, err)
+		}
+		return nil
+	})
+	return claimed, err
+}
+
+// DeleteExpired removes the archives past their retention and returns how
+// many were deleted
+func (s *ExportService) DeleteExpired() (int64, error) {
+	result := config.DB.Where("expires_at < ?", time.Now()).Delete(&models.DataExport{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete expired exports: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// exportLikeRow is a like joined with its track
+type exportLikeRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	SetID     *uuid.UUID
+	TrackID   uuid.UUID
+	Name      string
+	Artist    string
+	URI       string
+}
+
+const exportLikesSQL = `
+	SELECT likes.id, likes.created_at, likes.set_id, tracks.id AS track_id, tracks.name, tracks.artist, tracks.uri
+	FROM likes
+	JOIN tracks ON tracks.id = likes.track_id`
+
+// collect gathers the personal data of the user
+func (s *ExportService) collect(userID uuid.UUID) (*dto.UserExport, error) {
+	user, err := s.userRepository.FindByFilter(map[string]interface{}{"id": userID}, "Genres")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+
+	export := dto.UserExport{
+		ExportedAt: time.Now(),
+		Profile: dto.ExportProfile{
+			ID:                  user.ID,
+			Username:            user.Username,
+			CreatedAt:           user.CreatedAt,
+			ProfilePicURL:       user.ProfilePicURL,
+			SpotifyUserID:       user.SpotifyUserID,
+			SpotifyPlaylistLink: user.SpotifyPlaylistLink,
+			Tier:                user.Tier,
+			HasPaid:             user.HasPaid,
+		},
+		Genres:        make([]models.GenreName, 0, len(user.Genres)),
+		Sets:          make([]dto.ExportSet, 0),
+		LikesGiven:    make([]dto.ExportLike, 0),
+		LikesReceived: make([]dto.ExportLike, 0),
+		Leaderboard:   make([]dto.ExportLeaderboardEntry, 0),
+	}
+	for _, genre := range user.Genres {
+		export.Genres = append(export.Genres, genre.Name)
+	}
+
+	sets, err := s.setRepository.FindAllByFilter(map[string]interface{}{"user_id": userID}, "Tracks")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find sets: %w", err)
+	}
+	for _, set := range sets {
+		exportSet := dto.ExportSet{
+			ID:        set.ID,
+			Name:      set.Name,
+			Link:      set.Link,
+			CreatedAt: set.CreatedAt,
+			Tracks:    make([]dto.ExportTrack, 0, len(set.Tracks)),
+		}
+		for _, track := range set.Tracks {
+			exportSet.Tracks = append(exportSet.Tracks, dto.ExportTrack{ID: track.ID, Name: track.Name, Artist: track.Artist, URI: track.URI})
+		}
+		export.Sets = append(export.Sets, exportSet)
+	}
+
+	var given, received []exportLikeRow
+	if err := config.DB.Raw(exportLikesSQL+`
+		WHERE likes.user_id = ?
+		ORDER BY likes.created_at`, userID).Scan(&given).Error; err != nil {
+		return nil, fmt.Errorf("failed to find likes given: %w", err)
+	}
+	// The likers are left out, they are not part of this user's data
+	if err := config.DB.Raw(exportLikesSQL+`
+		JOIN sets ON sets.id = likes.set_id
+		WHERE sets.user_id = ? AND likes.user_id <> ?
+		ORDER BY likes.created_at`, userID, userID).Scan(&received).Error; err != nil {
+		return nil, fmt.Errorf("failed to find likes received: %w", err)
+	}
+	for _, row := range given {
+		export.LikesGiven = append(export.LikesGiven, row.toExportLike())
+	}
+	for _, row := range received {
+		export.LikesReceived = append(export.LikesReceived, row.toExportLike())
+	}
+
+	var standings []models.LeaderboardStanding
+	if err := config.DB.Where("user_id = ?", userID).Order("period, period_start").Find(&standings).Error; err != nil {
+		return nil, fmt.Errorf("failed to find leaderboard history: %w", err)
+	}
+	for _, standing := range standings {
+		export.Leaderboard = append(export.Leaderboard, dto.ExportLeaderboardEntry{
+			Period:      standing.Period,
+			PeriodStart: standing.PeriodStart,
+			Likes:       standing.Likes,
+		})
+	}
+
+	return &export, nil
+}
+
+// buildArchive zips the data of the user as data.json, with a CSV file per section
+func (s *ExportService) buildArchive(userID uuid.UUID) ([]byte, error) {
+	export, err := s.collect(userID)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode export: %w", err)
+	}
+
+	genres := [][]string{{"genre"}}
+	for _, genre := range export.Genres {
+		genres = append(genres, []string{string(genre)})
+	}
+	sets := [][]string{{"set_id", "set_name", "set_created_at", "track_id", "track_name", "artist", "uri"}}
+	for _, set := range export.Sets {
+		for _, track := range set.Tracks {
+			sets = append(sets, []string{set.ID.String(), set.Name, set.CreatedAt.Format(time.RFC3339), track.ID.String(), track.Name, track.Artist, track.URI})
+		}
+	}
+	leaderboard := [][]string{{"period", "period_start", "likes"}}
+	for _, entry := range export.Leaderboard {
+		leaderboard = append(leaderboard, []string{string(entry.Period), entry.PeriodStart.Format(time.RFC3339), strconv.Itoa(entry.Likes)})
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"data.json", data},
+		{"genres.csv", encodeCSV(genres)},
+		{"sets.csv", encodeCSV(sets)},
+		{"likes_given.csv", encodeCSV(likesCSV(export.LikesGiven))},
+		{"likes_received.csv", encodeCSV(likesCSV(export.LikesReceived))},
+		{"leaderboard.csv", encodeCSV(leaderboard)},
+	}
+	for _, file := range files {
+		w, err := zw.Create(file.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s: %w", file.name, err)
+		}
+		if _, err := w.Write(file.data); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (r exportLikeRow) toExportLike() dto.ExportLike {
+	return dto.ExportLike{
+		ID:        r.ID,
+		CreatedAt: r.CreatedAt,
+		SetID:     r.SetID,
+		Track:     dto.ExportTrack{ID: r.TrackID, Name: r.Name, Artist: r.Artist, URI: r.URI},
+	}
+}
+
+func likesCSV(likes []dto.ExportLike) [][]string {
+	records := [][]string{{"like_id", "created_at", "set_id", "track_id", "track_name", "artist", "uri"}}
+	for _, like := range likes {
+		setID := ""
+		if like.SetID != nil {
+			setID = like.SetID.String()
+		}
+		records = append(records, []string{like.ID.String(), like.CreatedAt.Format(time.RFC3339), setID, like.Track.ID.String(), like.Track.Name, like.Track.Artist, like.Track.URI})
+	}
+	return records
+}
+
+func encodeCSV(records [][]string) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	// Writing to a buffer can't fail
+	_ = w.WriteAll(records)
+	return buf.Bytes()
+}
+
+func dataExportResp(export *models.DataExport) *dto.GetDataExportResp {
+	return &dto.GetDataExportResp{
+		ID:          export.ID,
+		Status:      export.Status,
+		CreatedAt:   export.CreatedAt,
+		CompletedAt: export.CompletedAt,
+		ExpiresAt:   export.ExpiresAt,
+	}
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/config"
+	"github.com/VincentBaron/bangr/backend/internal/dto"
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/zmb3/spotify/v2"
+	"gorm.io/gorm"
+)
+
+// maxHouseSetTracks is the number of tracks Spotify resolves in one request
+const maxHouseSetTracks = 50
+
+var (
+	ErrHouseSetNotFound     = errors.New("house set not found")
+	ErrInvalidHouseSetDates = errors.New("a house set must end after it starts")
+	ErrUnknownGenre         = errors.New("unknown genre")
+	ErrInvalidTrackURI      = errors.New("invalid Spotify track URI")
+	ErrTooManyTracks        = fmt.Errorf("a house set holds at most %d tracks", maxHouseSetTracks)
+)
+
+type HouseSetService struct {
+	houseSetRepository *repositories.Repository[models.HouseSet]
+	genreRepository    *repositories.Repository[models.Genre]
+	trackRepository    *repositories.Repository[models.Track]
+}
+
+func NewHouseSetService(houseSetRepo *repositories.Repository[models.HouseSet], genreRepo *repositories.Repository[models.Genre], trackRepo *repositories.Repository[models.Track]) *HouseSetService {
+	return &HouseSetService{
+		houseSetRepository: houseSetRepo,
+		genreRepository:    genreRepo,
+		trackRepository:    trackRepo,
+	}
+}
+
+// List returns every house set, expired ones included, in display order
+func (s *HouseSetService) List() ([]models.HouseSet, error) {
+	houseSets := make([]models.HouseSet, 0)
+	if err := config.DB.Preload("Genres").Preload("Tracks").
+		Order("display_order, starts_at").Find(&houseSets).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to find house sets: %w", err)
+	}
+	return houseSets, nil
+}
+
+// Active returns the house sets shown at t to a viewer with the genres, in display order
+func (s *HouseSetService) Active(t time.Time, genres map[models.GenreName]bool) ([]models.HouseSet, error) {
+	var houseSets []models.HouseSet
+	if err := config.DB.Preload("Genres").Preload("Tracks").
+		Where("starts_at <= ? AND (ends_at IS NULL OR ends_at > ?)", t, t).
+		Order("display_order, starts_at").Find(&houseSets).Error; err != nil {
+		return nil, fmt.Errorf("failed to find house sets: %w", err)
+	}
+
+	active := make([]models.HouseSet, 0, len(houseSets))
+	for _, houseSet := range houseSets {
+		if houseSet.Targets(genres) {
+			active = append(active, houseSet)
+		}
+	}
+	return active, nil
+}
+
+// Create saves a house set, its tracks are looked up on Spotify
+func (s *HouseSetService) Create(c *gin.Context, req dto.PostHouseSetReq) (*models.HouseSet, error) {
+	if req.EndsAt != nil && !req.EndsAt.After(req.StartsAt) {
+		return nil, ErrInvalidHouseSetDates
+	}
+	genres, err := s.resolveGenres(req.Genres)
+	if err != nil {
+		return nil, err
+	}
+	tracks, err := s.resolveTracks(c, req.TrackURIs)
+	if err != nil {
+		return nil, err
+	}
+
+	houseSet := models.HouseSet{
+		Name:          req.Name,
+		Curator:       req.Curator,
+		ProfilePicURL: req.ProfilePicURL,
+		Link:          req.Link,
+		StartsAt:      req.StartsAt,
+		EndsAt:        req.EndsAt,
+		DisplayOrder:  req.DisplayOrder,
+		Genres:        genres,
+		Tracks:        tracks,
+	}
+	if err := s.houseSetRepository.Save(&houseSet); err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to save house set: %w", err)
+	}
+	return &houseSet, nil
+}
+
+// Update changes the fields set in the request
+func (s *HouseSetService) Update(c *gin.Context, id uuid.UUID, req dto.PatchHouseSetReq) (*models.HouseSet, error) {
+	houseSet, err := s.houseSetRepository.FindByFilter(map[string]interface{}{"id": id}, "Genres", "Tracks")
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrHouseSetNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to find house set: %w", err)
+	}
+
+	if req.Name != nil {
+		houseSet.Name = *req.Name
+	}
+	if req.Curator != nil {
+		houseSet.Curator = *req.Curator
+	}
+	if req.ProfilePicURL != nil {
+		houseSet.ProfilePicURL = *req.ProfilePicURL
+	}
+	if req.Link != nil {
+		houseSet.Link = *req.Link
+	}
+	if req.StartsAt != nil {
+		houseSet.StartsAt = *req.StartsAt
+	}
+	if req.EndsAt != nil {
+		houseSet.EndsAt = req.EndsAt
+	}
+	if req.ClearEndsAt {
+		houseSet.EndsAt = nil
+	}
+	if req.DisplayOrder != nil {
+		houseSet.DisplayOrder = *req.DisplayOrder
+	}
+	if houseSet.EndsAt != nil && !houseSet.EndsAt.After(houseSet.StartsAt) {
+		return nil, ErrInvalidHouseSetDates
+	}
+
+	var genres []models.Genre
+	if req.Genres != nil {
+		if genres, err = s.resolveGenres(*req.Genres); err != nil {
+			return nil, err
+		}
+	}
+	var tracks []models.Track
+	if req.TrackURIs != nil {
+		if tracks, err = s.resolveTracks(c, *req.TrackURIs); err != nil {
+			return nil, err
+		}
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Genres", "Tracks").Save(houseSet).Error; err != nil {
+			return err
+		}
+		if req.Genres != nil {
+			if err := tx.Model(houseSet).Association("Genres").Replace(genres); err != nil {
+				return err
+			}
+		}
+		if req.TrackURIs != nil {
+			if err := tx.Model(houseSet).Association("Tracks").Replace(tracks); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to update house set: %w", err)
+	}
+	return houseSet, nil
+}
+
+// Delete removes the house set, its tracks are kept for the likes they hold
+func (s *HouseSetService) Delete(id uuid.UUID) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		houseSet := models.HouseSet{ID: id}
+		result := tx.Select("Genres", "Tracks").Delete(&houseSet)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete house set: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrHouseSetNotFound
+		}
+		return nil
+	})
+}
+
+func (s *HouseSetService) resolveGenres(names []models.GenreName) ([]models.Genre, error) {
+	if len(names) == 0 {
+		return []models.Genre{}, nil
+	}
+	genres, err := s.genreRepository.FindAllByFilter(map[string]interface{}{"name": names})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find genres: %w", err)
+	}
+	if len(genres) != len(names) {
+		return nil, ErrUnknownGenre
+	}
+	return genres, nil
+}
+
+// resolveTracks looks up the tracks of the URIs on Spotify with the client of the admin
+func (s *HouseSetService) resolveTracks(c *gin.Context, uris []string) ([]models.Track, error) {
+	if len(uris) > maxHouseSetTracks {
+		return nil, ErrTooManyTracks
+	}
+	spotifyClient := c.MustGet("spotifyClient").(*spotify.Client)
+	return resolveSpotifyTracks(c, spotifyClient, s.trackRepository, uris)
+}
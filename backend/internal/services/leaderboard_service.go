@@ -1,9 +1,13 @@
 package services
 
 import (
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
-	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/VincentBaron/bangr/backend/internal/config"
 	"github.com/VincentBaron/bangr/backend/internal/dto"
@@ -11,58 +15,230 @@ import (
 	"github.com/VincentBaron/bangr/backend/internal/repositories"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// leaderboardNeighbours is the number of entries shown around the caller
+const leaderboardNeighbours = 2
+
+// rankedStandingsSQL ranks the standings of a period, ties sharing a rank
+const rankedStandingsSQL = `
+	SELECT s.user_id, u.username, u.profile_pic_url, s.likes,
+		RANK() OVER (ORDER BY s.likes DESC) AS rank,
+		ROW_NUMBER() OVER (ORDER BY s.likes DESC, s.user_id) AS position
+	FROM leaderboard_standings s
+	JOIN users u ON u.id = s.user_id
+	WHERE s.period = @period AND s.period_start = @start AND s.likes > 0
+		AND u.deletion_scheduled_at IS NULL AND u.banned_at IS NULL`
+
 type LeaderboardService struct {
 	trackRepository *repositories.Repository[models.Track]
 	likeRepository  *repositories.Repository[models.Like]
+	roundService    *RoundService
 }
 
-func NewLeaderboardService(trackRepo *repositories.Repository[models.Track], likeRepo *repositories.Repository[models.Like]) *LeaderboardService {
+func NewLeaderboardService(trackRepo *repositories.Repository[models.Track], likeRepo *repositories.Repository[models.Like], roundService *RoundService) *LeaderboardService {
 	return &LeaderboardService{
 		trackRepository: trackRepo,
 		likeRepository:  likeRepo,
+		roundService:    roundService,
 	}
 }
 
-func (s *LeaderboardService) GetLeaderboard(c *gin.Context) ([]dto.LeaderboardEntry, error) {
-	// Fetch all likes with user information
-	var likes []models.Like
-	if err := config.DB.Model(&models.Like{}).
-		Preload("User").
-		Find(&likes).Error; err != nil {
+// GetLeaderboard returns a page of the standings of the period, ordered by
+// likes received. The cursor is the one returned with the previous page.
+func (s *LeaderboardService) GetLeaderboard(c *gin.Context, params models.LeaderboardQueryParams) (*dto.LeaderboardPage, error) {
+	start, _, err := s.periodStart(params.Period, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	args := map[string]interface{}{
+		"period": params.Period,
+		"start":  start,
+		"limit":  params.Limit + 1,
+	}
+	where := ""
+	if params.Cursor != "" {
+		likes, userID, err := decodeLeaderboardCursor(params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		where = "WHERE likes < @likes OR (likes = @likes AND user_id > @user_id)"
+		args["likes"] = likes
+		args["user_id"] = userID
+	}
+
+	entries := make([]dto.LeaderboardEntry, 0)
+	if err := config.DB.Raw("SELECT * FROM ("+rankedStandingsSQL+") ranked "+where+" ORDER BY position LIMIT @limit", args).
+		Scan(&entries).Error; err != nil {
 		log.Println(err)
-		return nil, fmt.Errorf("failed to fetch likes: %w", err)
+		return nil, fmt.Errorf("failed to fetch leaderboard: %w", err)
 	}
 
-	// Map user IDs to their like counts and user info
-	userLikesMap := make(map[uuid.UUID]struct {
-		Count int
-		User  models.User
-	})
+	page := dto.LeaderboardPage{Entries: entries}
+	if len(entries) > params.Limit {
+		page.Entries = entries[:params.Limit]
+		last := page.Entries[len(page.Entries)-1]
+		page.NextCursor = encodeLeaderboardCursor(last.Likes, last.UserID)
+	}
+	return &page, nil
+}
+
+// GetMyStanding returns the rank and likes of the current user for the period,
+// along with the entries right above and below them
+func (s *LeaderboardService) GetMyStanding(c *gin.Context, period models.LeaderboardPeriod) (*dto.LeaderboardMeResp, error) {
+	user := c.MustGet("user").(*models.User)
+	start, _, err := s.periodStart(period, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	type rankedEntry struct {
+		dto.LeaderboardEntry
+		Position int
+	}
+	var rows []rankedEntry
+	if err := config.DB.Raw(`
+		WITH ranked AS (`+rankedStandingsSQL+`),
+		me AS (SELECT position FROM ranked WHERE user_id = @user_id)
+		SELECT ranked.* FROM ranked, me
+		WHERE ranked.position BETWEEN me.position - @neighbours AND me.position + @neighbours
+		ORDER BY ranked.position`,
+		map[string]interface{}{
+			"period":     period,
+			"start":      start,
+			"user_id":    user.ID,
+			"neighbours": leaderboardNeighbours,
+		}).Scan(&rows).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to fetch standing: %w", err)
+	}
 
-	for _, like := range likes {
-		entry := userLikesMap[like.UserID]
-		entry.Count++
-		entry.User = like.User
-		userLikesMap[like.UserID] = entry
+	resp := dto.LeaderboardMeResp{Neighbours: make([]dto.LeaderboardEntry, 0)}
+	for _, row := range rows {
+		if row.UserID == user.ID {
+			resp.Rank = row.Rank
+			resp.Likes = row.Likes
+			continue
+		}
+		resp.Neighbours = append(resp.Neighbours, row.LeaderboardEntry)
 	}
+	return &resp, nil
+}
 
-	// Convert map to slice and sort by like count
-	leaderboard := make([]dto.LeaderboardEntry, 0)
-	for _, entry := range userLikesMap {
-		leaderboard = append(leaderboard, dto.LeaderboardEntry{
-			UserID:        entry.User.ID,
-			Username:      entry.User.Username,
-			ProfilePicURL: entry.User.ProfilePicURL,
-			Likes:         entry.Count,
-		})
+// ApplyLike adds delta to the standings of the set owner for every period
+// containing likedAt. It must run in the transaction saving or deleting the like.
+// Likes older than the first round have no week standing.
+func (s *LeaderboardService) ApplyLike(tx *gorm.DB, ownerID uuid.UUID, likedAt time.Time, delta int) error {
+	now := time.Now()
+	for _, period := range models.LeaderboardPeriods {
+		start, roundID, err := s.periodStart(period, likedAt)
+		if period == models.LeaderboardPeriodWeek && errors.Is(err, ErrRoundNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		standing := models.LeaderboardStanding{
+			Period:      period,
+			PeriodStart: start,
+			UserID:      ownerID,
+			UpdatedAt:   now,
+			RoundID:     roundID,
+		}
+		if delta > 0 {
+			standing.Likes = delta
+		}
+		err = tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "period"}, {Name: "period_start"}, {Name: "user_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"likes":      gorm.Expr("GREATEST(leaderboard_standings.likes + ?, 0)", delta),
+				"updated_at": now,
+			}),
+		}).Create(&standing).Error
+		if err != nil {
+			return fmt.Errorf("failed to update %s standing: %w", period, err)
+		}
 	}
+	return nil
+}
 
-	// Sort leaderboard by likes in descending order
-	sort.Slice(leaderboard, func(i, j int) bool {
-		return leaderboard[i].Likes > leaderboard[j].Likes
+// RebuildStandings recomputes the standings of the current periods from the
+// likes table, fixing any drift of the incremental updates
+func (s *LeaderboardService) RebuildStandings() error {
+	now := time.Now()
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		for _, period := range models.LeaderboardPeriods {
+			start, roundID, err := s.periodStart(period, now)
+			if err != nil {
+				return err
+			}
+			if err := tx.Where("period = ? AND period_start = ?", period, start).
+				Delete(&models.LeaderboardStanding{}).Error; err != nil {
+				return fmt.Errorf("failed to clear %s standings: %w", period, err)
+			}
+			if err := tx.Exec(`
+				INSERT INTO leaderboard_standings (period, period_start, round_id, user_id, likes, updated_at)
+				SELECT ?, ?, ?, sets.user_id, COUNT(likes.id), ?
+				FROM likes
+				JOIN sets ON sets.id = likes.set_id
+				WHERE likes.user_id <> sets.user_id AND likes.created_at >= ?
+				GROUP BY sets.user_id`,
+				period, start, roundID, now, start).Error; err != nil {
+				return fmt.Errorf("failed to rebuild %s standings: %w", period, err)
+			}
+		}
+		return nil
 	})
+}
 
-	return leaderboard, nil
+// periodStart returns the time from which likes count for the period
+// containing t, the zero time meaning no lower bound. Weeks are the rounds,
+// whose ID is returned along.
+func (s *LeaderboardService) periodStart(period models.LeaderboardPeriod, t time.Time) (time.Time, *uuid.UUID, error) {
+	if period == models.LeaderboardPeriodWeek {
+		round, err := s.roundService.At(t)
+		if err != nil {
+			return time.Time{}, nil, err
+		}
+		return round.OpensAt, &round.ID, nil
+	}
+
+	// Months and seasons follow the calendar of the round schedule
+	t = t.In(s.roundService.Location())
+	switch period {
+	case models.LeaderboardPeriodMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()), nil, nil
+	case models.LeaderboardPeriodSeason:
+		firstMonth := t.Month() - (t.Month()-1)%3
+		return time.Date(t.Year(), firstMonth, 1, 0, 0, 0, 0, t.Location()), nil, nil
+	}
+	return time.Time{}, nil, nil
+}
+
+func encodeLeaderboardCursor(likes int, userID uuid.UUID) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(likes) + ":" + userID.String()))
+}
+
+func decodeLeaderboardCursor(cursor string) (int, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, uuid.Nil, ErrInvalidCursor
+	}
+	likesPart, userPart, found := strings.Cut(string(raw), ":")
+	if !found {
+		return 0, uuid.Nil, ErrInvalidCursor
+	}
+	likes, err := strconv.Atoi(likesPart)
+	if err != nil {
+		return 0, uuid.Nil, ErrInvalidCursor
+	}
+	userID, err := uuid.Parse(userPart)
+	if err != nil {
+		return 0, uuid.Nil, ErrInvalidCursor
+	}
+	return likes, userID, nil
 }
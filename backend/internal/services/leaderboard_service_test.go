@@ -0,0 +1,93 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/repositories"
+	"github.com/google/uuid"
+)
+
+func TestApplyLikeBeforeFirstRound(t *testing.T) {
+	db := testDB(t)
+
+	now := time.Now()
+	first := models.Round{
+		Number:             910001,
+		OpensAt:            now.AddDate(0, 0, -1),
+		SubmissionDeadline: now,
+		VotingStartsAt:     now,
+		ClosesAt:           now.AddDate(0, 0, 6),
+	}
+	owner := models.User{Username: "pre-rounds-curator"}
+	for _, row := range []interface{}{&first, &owner} {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatalf("creating %T: %v", row, err)
+		}
+	}
+
+	roundService := NewRoundService(repositories.NewRepository[models.Round](db), repositories.NewRepository[models.RoundSchedule](db))
+	leaderboardService := NewLeaderboardService(repositories.NewRepository[models.Track](db), repositories.NewRepository[models.Like](db), roundService)
+
+	// A like saved before the rounds migration, deleted by an unlike or an account purge
+	likedAt := now.AddDate(0, 0, -60)
+	for _, delta := range []int{1, -1} {
+		if err := leaderboardService.ApplyLike(db, owner.ID, likedAt, delta); err != nil {
+			t.Fatalf("applying like %+d: %v", delta, err)
+		}
+
+		var standings []models.LeaderboardStanding
+		if err := db.Where("user_id = ?", owner.ID).Find(&standings).Error; err != nil {
+			t.Fatalf("loading standings: %v", err)
+		}
+		likes := make(map[models.LeaderboardPeriod]int)
+		for _, standing := range standings {
+			likes[standing.Period] = standing.Likes
+		}
+		if _, ok := likes[models.LeaderboardPeriodWeek]; ok {
+			t.Errorf("got a week standing for a like older than the first round")
+		}
+		want := 0
+		if delta > 0 {
+			want = 1
+		}
+		for _, period := range []models.LeaderboardPeriod{models.LeaderboardPeriodMonth, models.LeaderboardPeriodSeason, models.LeaderboardPeriodAll} {
+			if got, ok := likes[period]; !ok || got != want {
+				t.Errorf("after %+d got %s likes %d (saved: %v), want %d", delta, period, got, ok, want)
+			}
+		}
+	}
+}
+
+func TestLeaderboardCursor(t *testing.T) {
+	userID := uuid.MustParse("7d3f0c4e-93a8-4a53-9b5e-0f6a2f3f1d2c")
+	for _, likes := range []int{0, 1, 4096} {
+		gotLikes, gotUserID, err := decodeLeaderboardCursor(encodeLeaderboardCursor(likes, userID))
+		if err != nil || gotLikes != likes || gotUserID != userID {
+			t.Errorf("round trip of %d likes got %d, %s, %v", likes, gotLikes, gotUserID, err)
+		}
+	}
+
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "not a cursor!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte("1:" + userID.String()))},
+		{"no separator", encode("1" + userID.String())},
+		{"invalid likes", encode("many:" + userID.String())},
+		{"invalid user", encode("1:someone")},
+		{"empty", encode("")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := decodeLeaderboardCursor(tt.cursor); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("got error %v, want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/config"
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// loginFailuresBeforeLockout is the number of failed logins allowed in a row
+	loginFailuresBeforeLockout = 5
+	// loginLockoutBase is the first lockout, doubled on every further failure
+	loginLockoutBase = time.Minute
+	loginLockoutMax  = 24 * time.Hour
+	// loginFailureWindow forgets the failures after a quiet period
+	loginFailureWindow = 24 * time.Hour
+)
+
+// LoginLockedError is returned while a username is locked out
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return "too many failed logins, try again later"
+}
+
+// LoginGuardService locks out usernames progressively after failed logins
+type LoginGuardService struct {
+	loginAttemptRepository *repositories.Repository[models.LoginAttempt]
+	auditService           *AuditService
+}
+
+func NewLoginGuardService(loginAttemptRepo *repositories.Repository[models.LoginAttempt], auditService *AuditService) *LoginGuardService {
+	return &LoginGuardService{
+		loginAttemptRepository: loginAttemptRepo,
+		auditService:           auditService,
+	}
+}
+
+// Check returns a LoginLockedError while the username is locked out
+func (s *LoginGuardService) Check(username string) error {
+	attempt, err := s.loginAttemptRepository.FindByFilter(map[string]interface{}{"username": loginKey(username)})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		log.Println(err)
+		return fmt.Errorf("failed to find login attempts: %w", err)
+	}
+	if attempt.LockedUntil != nil && attempt.LockedUntil.After(time.Now()) {
+		return &LoginLockedError{RetryAfter: time.Until(*attempt.LockedUntil)}
+	}
+	return nil
+}
+
+// Fail counts a failed login of the username and locks it out once the
+// failures pile up, userID is nil when the username matches no account
+func (s *LoginGuardService) Fail(c *gin.Context, username string, userID *uuid.UUID) {
+	now := time.Now()
+	var failures int
+	err := config.DB.Raw(`
+		INSERT INTO login_attempts (username, failures, last_failure_at)
+		VALUES (@username, 1, @now)
+		ON CONFLICT (username) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at < @window THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure_at = @now
+		RETURNING failures`,
+		map[string]interface{}{"username": loginKey(username), "now": now, "window": now.Add(-loginFailureWindow)}).Scan(&failures).Error
+	if err != nil {
+		log.Printf("Couldn't count failed login of %s: %v", username, err)
+	}
+	s.auditService.Record(c, models.AuditEventLoginFailed, userID, username, fmt.Sprintf("failure %d", failures))
+
+	if failures < loginFailuresBeforeLockout {
+		return
+	}
+	lockout := loginLockoutMax
+	if shift := failures - loginFailuresBeforeLockout; shift < 11 {
+		lockout = loginLockoutBase << shift
+		if lockout > loginLockoutMax {
+			lockout = loginLockoutMax
+		}
+	}
+	if err := config.DB.Model(&models.LoginAttempt{}).Where("username = ?", loginKey(username)).
+		Update("locked_until", now.Add(lockout)).Error; err != nil {
+		log.Printf("Couldn't lock out %s: %v", username, err)
+		return
+	}
+	s.auditService.Record(c, models.AuditEventLoginLocked, userID, username, fmt.Sprintf("locked for %s", lockout))
+}
+
+// Succeed clears the failures of the username after a successful login
+func (s *LoginGuardService) Succeed(c *gin.Context, username string, userID uuid.UUID) {
+	if err := config.DB.Where("username = ?", loginKey(username)).Delete(&models.LoginAttempt{}).Error; err != nil {
+		log.Printf("Couldn't clear login attempts of %s: %v", username, err)
+	}
+	s.auditService.Record(c, models.AuditEventLoginSucceeded, &userID, username, "")
+}
+
+// DeleteExpired removes the attempts past the failure window and returns
+// how many were deleted
+func (s *LoginGuardService) DeleteExpired() (int64, error) {
+	now := time.Now()
+	result := config.DB.Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", now.Add(-loginFailureWindow), now).
+		Delete(&models.LoginAttempt{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete login attempts: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// loginKey makes the lockout of a username case insensitive
+func loginKey(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/config"
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/repositories"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// oauthStateTTL is how long a user has to complete the Spotify authorization
+	oauthStateTTL = 15 * time.Minute
+	// loginCodeTTL is how long the frontend has to exchange a login code
+	loginCodeTTL = time.Minute
+)
+
+var (
+	ErrInvalidOAuthState = errors.New("invalid or expired state parameter")
+	ErrInvalidLoginCode  = errors.New("invalid or expired login code")
+)
+
+type OAuthStateService struct {
+	stateRepository *repositories.Repository[models.OAuthState]
+}
+
+func NewOAuthStateService(stateRepo *repositories.Repository[models.OAuthState]) *OAuthStateService {
+	return &OAuthStateService{
+		stateRepository: stateRepo,
+	}
+}
+
+// Create stores a new random state and PKCE verifier for the purpose and
+// returns them. userID is nil when the user is not known yet.
+func (s *OAuthStateService) Create(purpose models.OAuthPurpose, userID *uuid.UUID) (*models.OAuthState, error) {
+	value, err := randomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate state: %w", err)
+	}
+
+	state := models.OAuthState{
+		State:        value,
+		ExpiresAt:    time.Now().Add(oauthStateTTL),
+		Purpose:      purpose,
+		UserID:       userID,
+		CodeVerifier: oauth2.GenerateVerifier(),
+	}
+	if err := s.stateRepository.Save(&state); err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to save state: %w", err)
+	}
+	return &state, nil
+}
+
+// Consume deletes the state and returns it if it has not expired yet, so that
+// a state can only be used once
+func (s *OAuthStateService) Consume(value string) (*models.OAuthState, error) {
+	var states []models.OAuthState
+	if err := config.DB.Clauses(clause.Returning{}).
+		Where("state = ?", value).
+		Delete(&states).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to consume state: %w", err)
+	}
+	if len(states) == 0 || states[0].ExpiresAt.Before(time.Now()) {
+		return nil, ErrInvalidOAuthState
+	}
+	return &states[0], nil
+}
+
+// CreateLoginCode returns a single use code the user's session can be opened with
+func (s *OAuthStateService) CreateLoginCode(userID uuid.UUID) (string, error) {
+	code, err := randomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate login code: %w", err)
+	}
+
+	loginCode := models.LoginCode{
+		CodeHash:  hashToken(code),
+		ExpiresAt: time.Now().Add(loginCodeTTL),
+		UserID:    userID,
+	}
+	if err := config.DB.Create(&loginCode).Error; err != nil {
+		log.Println(err)
+		return "", fmt.Errorf("failed to save login code: %w", err)
+	}
+	return code, nil
+}
+
+// ConsumeLoginCode deletes the login code and returns the user it was issued for
+func (s *OAuthStateService) ConsumeLoginCode(code string) (uuid.UUID, error) {
+	var loginCodes []models.LoginCode
+	if err := config.DB.Clauses(clause.Returning{}).
+		Where("code_hash = ?", hashToken(code)).
+		Delete(&loginCodes).Error; err != nil {
+		log.Println(err)
+		return uuid.Nil, fmt.Errorf("failed to consume login code: %w", err)
+	}
+	if len(loginCodes) == 0 || loginCodes[0].ExpiresAt.Before(time.Now()) {
+		return uuid.Nil, ErrInvalidLoginCode
+	}
+	return loginCodes[0].UserID, nil
+}
+
+// DeleteExpired removes the states of abandoned authorizations and the
+// login codes never exchanged
+func (s *OAuthStateService) DeleteExpired() (int64, error) {
+	result := config.DB.Where("expires_at < ?", time.Now()).Delete(&models.OAuthState{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete expired states: %w", result.Error)
+	}
+	deleted := result.RowsAffected
+
+	result = config.DB.Where("expires_at < ?", time.Now()).Delete(&models.LoginCode{})
+	if result.Error != nil {
+		return deleted, fmt.Errorf("failed to delete expired login codes: %w", result.Error)
+	}
+	return deleted + result.RowsAffected, nil
+}
+
+// randomToken returns n random bytes encoded for use in URLs
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
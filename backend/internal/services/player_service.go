@@ -1,23 +1,47 @@
 package services
 
 import (
-	"fmt"
+	"errors"
+	"time"
 
 	"github.com/VincentBaron/bangr/backend/internal/models"
 	"github.com/gin-gonic/gin"
 	"github.com/zmb3/spotify/v2"
 )
 
-type PlayerService struct{}
+// tierRecheckInterval is the time the tier checked by the player is trusted,
+// the player polls and would otherwise ask Spotify on every call
+const tierRecheckInterval = 10 * time.Minute
 
-func NewPlayerService() *PlayerService {
-	return &PlayerService{}
+var ErrPremiumRequired = errors.New("Spotify Premium subscription required")
+
+type PlayerService struct {
+	userService *UserService
+}
+
+func NewPlayerService(userService *UserService) *PlayerService {
+	return &PlayerService{
+		userService: userService,
+	}
 }
 
 func (s *PlayerService) HandlePlayer(c *gin.Context, spotifyClient *spotify.Client, params models.HandlerPlayerQueryParams) (*spotify.CurrentlyPlaying, error) {
 	var currentlyPlaying *spotify.CurrentlyPlaying
 	var err error
 
+	// Playback needs Premium, check again in case the user upgraded since
+	user := c.MustGet("user").(*models.User)
+	if user.Tier != models.UserTierPremium {
+		if user.TierCheckedAt == nil || time.Since(*user.TierCheckedAt) >= tierRecheckInterval {
+			if err := s.userService.RefreshTier(c, user, spotifyClient); err != nil {
+				return nil, err
+			}
+		}
+		if user.Tier != models.UserTierPremium {
+			return nil, ErrPremiumRequired
+		}
+	}
+
 	// Handle player actions
 	switch params.Action {
 	case models.PlayerActionPlay:
@@ -41,7 +65,6 @@ func (s *PlayerService) HandlePlayer(c *gin.Context, spotifyClient *spotify.Clie
 	case models.PLayerActivate:
 		err = spotifyClient.TransferPlayback(c, params.DeviceID, false)
 		if err != nil {
-			fmt.Println("yolo1")
 			return nil, err
 		}
 	}
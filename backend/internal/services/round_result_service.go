@@ -0,0 +1,185 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/config"
+	"github.com/VincentBaron/bangr/backend/internal/dto"
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// roundResultsLimit is the number of tracks and curators listed in the results
+const roundResultsLimit = 50
+
+var ErrRoundNotClosed = errors.New("the round is not closed yet")
+
+type RoundResultService struct {
+	roundService *RoundService
+}
+
+func NewRoundResultService(roundService *RoundService) *RoundResultService {
+	return &RoundResultService{
+		roundService: roundService,
+	}
+}
+
+// CloseDue freezes the results of the rounds that ended and returns how many
+// it closed
+func (s *RoundResultService) CloseDue() (int64, error) {
+	var due []models.Round
+	if err := config.DB.Where("closed_at IS NULL AND closes_at <= ?", time.Now()).
+		Order("closes_at").Find(&due).Error; err != nil {
+		return 0, fmt.Errorf("failed to find rounds to close: %w", err)
+	}
+
+	var closed int64
+	for _, round := range due {
+		if err := s.close(round.ID); err != nil {
+			log.Println(err)
+			return closed, fmt.Errorf("failed to close round %d: %w", round.Number, err)
+		}
+		closed++
+	}
+	return closed, nil
+}
+
+// close ranks the tracks and curators of the round by the likes received from
+// other users, the track of the week and top curator being the first to reach
+// the most likes
+func (s *RoundResultService) close(id uuid.UUID) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the round so a concurrent job doesn't close it twice
+		var round models.Round
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&round, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if round.ClosedAt != nil {
+			return nil
+		}
+
+		if err := tx.Exec(`
+			INSERT INTO round_track_results (round_id, track_id, set_id, likes, rank, reached_at)
+			SELECT @round, likes.track_id, likes.set_id, COUNT(likes.id),
+				RANK() OVER (ORDER BY COUNT(likes.id) DESC), MAX(likes.created_at)
+			FROM likes
+			JOIN sets ON sets.id = likes.set_id
+			JOIN users u ON u.id = sets.user_id
+			WHERE likes.round_id = @round AND likes.user_id <> sets.user_id
+				AND u.deletion_scheduled_at IS NULL AND u.banned_at IS NULL
+			GROUP BY likes.track_id, likes.set_id`,
+			map[string]interface{}{"round": round.ID}).Error; err != nil {
+			return fmt.Errorf("failed to rank tracks: %w", err)
+		}
+		if err := tx.Exec(`
+			INSERT INTO round_curator_results (round_id, user_id, likes, rank, reached_at)
+			SELECT @round, sets.user_id, COUNT(likes.id),
+				RANK() OVER (ORDER BY COUNT(likes.id) DESC), MAX(likes.created_at)
+			FROM likes
+			JOIN sets ON sets.id = likes.set_id
+			JOIN users u ON u.id = sets.user_id
+			WHERE likes.round_id = @round AND likes.user_id <> sets.user_id
+				AND u.deletion_scheduled_at IS NULL AND u.banned_at IS NULL
+			GROUP BY sets.user_id`,
+			map[string]interface{}{"round": round.ID}).Error; err != nil {
+			return fmt.Errorf("failed to rank curators: %w", err)
+		}
+
+		result := models.RoundResult{RoundID: round.ID}
+		var topTrack models.RoundTrackResult
+		err := tx.Where("round_id = ?", round.ID).Order("rank, reached_at").First(&topTrack).Error
+		if err == nil {
+			result.TrackOfTheWeekID = &topTrack.TrackID
+			result.TrackOfTheWeekSetID = &topTrack.SetID
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		var topCurator models.RoundCuratorResult
+		err = tx.Where("round_id = ?", round.ID).Order("rank, reached_at").First(&topCurator).Error
+		if err == nil {
+			result.TopCuratorID = &topCurator.UserID
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err := tx.Create(&result).Error; err != nil {
+			return fmt.Errorf("failed to save results: %w", err)
+		}
+
+		now := time.Now()
+		round.ClosedAt = &now
+		if err := tx.Save(&round).Error; err != nil {
+			return err
+		}
+		log.Printf("Closed round %d", round.Number)
+		return nil
+	})
+}
+
+// Results returns the frozen results of a closed round
+func (s *RoundResultService) Results(id uuid.UUID) (*dto.GetRoundResultsResp, error) {
+	round, err := s.roundService.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if round.ClosedAt == nil {
+		return nil, ErrRoundNotClosed
+	}
+
+	var result models.RoundResult
+	if err := config.DB.First(&result, "round_id = ?", round.ID).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to find round results: %w", err)
+	}
+
+	tracks := make([]dto.RoundTrackEntry, 0)
+	if err := config.DB.Raw(`
+		SELECT r.rank, r.likes, r.track_id, t.uri, t.name, t.artist, t.img_url, t.preview_url,
+			r.set_id, u.username, u.profile_pic_url
+		FROM round_track_results r
+		JOIN tracks t ON t.id = r.track_id
+		JOIN sets s ON s.id = r.set_id
+		JOIN users u ON u.id = s.user_id
+		WHERE r.round_id = ?
+		ORDER BY r.rank, r.reached_at
+		LIMIT ?`, round.ID, roundResultsLimit).Scan(&tracks).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to fetch track results: %w", err)
+	}
+	curators := make([]dto.RoundCuratorEntry, 0)
+	if err := config.DB.Raw(`
+		SELECT r.rank, r.likes, r.user_id, u.username, u.profile_pic_url
+		FROM round_curator_results r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.round_id = ?
+		ORDER BY r.rank, r.reached_at
+		LIMIT ?`, round.ID, roundResultsLimit).Scan(&curators).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to fetch curator results: %w", err)
+	}
+
+	resp := dto.GetRoundResultsResp{
+		Round:    roundResp(round),
+		Tracks:   tracks,
+		Curators: curators,
+	}
+	// The winners are ranked first, they are missing when their account was deleted since
+	for i := range tracks {
+		if result.TrackOfTheWeekSetID != nil && tracks[i].SetID == *result.TrackOfTheWeekSetID &&
+			tracks[i].TrackID == *result.TrackOfTheWeekID {
+			resp.TrackOfTheWeek = &tracks[i]
+			break
+		}
+	}
+	for i := range curators {
+		if result.TopCuratorID != nil && curators[i].UserID == *result.TopCuratorID {
+			resp.TopCurator = &curators[i]
+			break
+		}
+	}
+	return &resp, nil
+}
@@ -0,0 +1,313 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/config"
+	"github.com/VincentBaron/bangr/backend/internal/dto"
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/repositories"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// roundsAhead is the number of upcoming rounds generated in advance
+const roundsAhead = 4
+
+var (
+	ErrRoundNotFound        = errors.New("round not found")
+	ErrInvalidRoundSchedule = errors.New("invalid round schedule")
+	ErrInvalidRoundDates    = errors.New("a round must open, close submissions, start voting and close in this order")
+	ErrInvalidSetSize       = fmt.Errorf("a set holds between 1 and %d tracks", models.MaxSetSize)
+	ErrInvalidSetSelection  = errors.New("invalid set selection")
+)
+
+type RoundService struct {
+	roundRepository         *repositories.Repository[models.Round]
+	roundScheduleRepository *repositories.Repository[models.RoundSchedule]
+}
+
+func NewRoundService(roundRepo *repositories.Repository[models.Round], roundScheduleRepo *repositories.Repository[models.RoundSchedule]) *RoundService {
+	return &RoundService{
+		roundRepository:         roundRepo,
+		roundScheduleRepository: roundScheduleRepo,
+	}
+}
+
+// Schedule returns the saved schedule, the default one until an admin saves it
+func (s *RoundService) Schedule() (*models.RoundSchedule, error) {
+	schedule, err := s.roundScheduleRepository.FindByFilter(map[string]interface{}{"id": 1})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		defaultSchedule := models.DefaultRoundSchedule()
+		return &defaultSchedule, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find round schedule: %w", err)
+	}
+	return schedule, nil
+}
+
+// UpdateSchedule saves the schedule and regenerates the upcoming rounds. The
+// current round is kept, closing at the next opening of the new schedule.
+func (s *RoundService) UpdateSchedule(req dto.PutRoundScheduleReq) (*models.RoundSchedule, error) {
+	schedule := models.RoundSchedule{
+		ID:              1,
+		Weekday:         req.Weekday,
+		Hour:            req.Hour,
+		Timezone:        req.Timezone,
+		LengthDays:      req.LengthDays,
+		SubmissionHours: req.SubmissionHours,
+		SetSize:         req.SetSize,
+		SetSelection:    req.SetSelection,
+	}
+	if schedule.SetSize == 0 {
+		schedule.SetSize = models.DefaultSetSize
+	}
+	if schedule.SetSelection == "" {
+		schedule.SetSelection = models.SetSelectionRecent
+	}
+	if err := schedule.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRoundSchedule, err)
+	}
+
+	now := time.Now()
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&schedule).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("opens_at > ?", now).Delete(&models.Round{}).Error; err != nil {
+			return err
+		}
+
+		var current models.Round
+		err := tx.Where("opens_at <= ? AND closes_at > ?", now, now).First(&current).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		current.ClosesAt = schedule.NextOpening(now)
+		if current.SubmissionDeadline.After(current.ClosesAt) {
+			current.SubmissionDeadline = current.ClosesAt
+		}
+		if current.VotingStartsAt.After(current.ClosesAt) {
+			current.VotingStartsAt = current.ClosesAt
+		}
+		return tx.Save(&current).Error
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to update round schedule: %w", err)
+	}
+
+	if err := s.EnsureRounds(now); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// EnsureRounds generates the rounds up to roundsAhead after the current one.
+// Without any round yet, the first one is the round of the schedule containing from.
+func (s *RoundService) EnsureRounds(from time.Time) error {
+	schedule, err := s.Schedule()
+	if err != nil {
+		return err
+	}
+
+	var last models.Round
+	err = config.DB.Order("opens_at DESC").First(&last).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		last = schedule.RoundOpeningAt(schedule.LastOpening(from))
+		last.Number = 1
+		err = s.createRound(&last)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find last round: %w", err)
+	}
+
+	// Rounds follow each other, the next one opens when the last one closes
+	horizon := time.Now()
+	if from.After(horizon) {
+		horizon = from
+	}
+	horizon = horizon.AddDate(0, 0, roundsAhead*schedule.LengthDays)
+	for last.ClosesAt.Before(horizon) {
+		next := schedule.RoundOpeningAt(last.ClosesAt)
+		next.Number = last.Number + 1
+		if err := s.createRound(&next); err != nil {
+			return fmt.Errorf("failed to create round %d: %w", next.Number, err)
+		}
+		last = next
+	}
+	return nil
+}
+
+// At returns the round containing t
+func (s *RoundService) At(t time.Time) (*models.Round, error) {
+	round, err := s.findAt(t)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if err := s.EnsureRounds(t); err != nil {
+			return nil, err
+		}
+		round, err = s.findAt(t)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRoundNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find round: %w", err)
+	}
+	return round, nil
+}
+
+// Current returns the round open now
+func (s *RoundService) Current() (*models.Round, error) {
+	return s.At(time.Now())
+}
+
+// CurrentResp returns the current round with its status
+func (s *RoundService) CurrentResp() (*dto.GetRoundResp, error) {
+	round, err := s.Current()
+	if err != nil {
+		return nil, err
+	}
+	resp := roundResp(round)
+	return &resp, nil
+}
+
+func (s *RoundService) Get(id uuid.UUID) (*models.Round, error) {
+	round, err := s.roundRepository.FindByFilter(map[string]interface{}{"id": id})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRoundNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find round: %w", err)
+	}
+	return round, nil
+}
+
+// GetByNumber returns the round with the number
+func (s *RoundService) GetByNumber(number int) (*models.Round, error) {
+	round, err := s.roundRepository.FindByFilter(map[string]interface{}{"number": number})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRoundNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find round: %w", err)
+	}
+	return round, nil
+}
+
+// Between returns the rounds opened so far that opened in [from, to), oldest first
+func (s *RoundService) Between(from time.Time, to time.Time) ([]models.Round, error) {
+	var rounds []models.Round
+	if err := config.DB.Where("opens_at >= ? AND opens_at < ? AND opens_at <= ?", from, to, time.Now()).
+		Order("opens_at").Find(&rounds).Error; err != nil {
+		return nil, fmt.Errorf("failed to find rounds: %w", err)
+	}
+	return rounds, nil
+}
+
+// Update moves the deadline or the start of the voting of a round, or
+// changes the size and selection of its sets
+func (s *RoundService) Update(id uuid.UUID, req dto.PatchRoundReq) (*models.Round, error) {
+	round, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if req.SubmissionDeadline != nil {
+		round.SubmissionDeadline = *req.SubmissionDeadline
+	}
+	if req.VotingStartsAt != nil {
+		round.VotingStartsAt = *req.VotingStartsAt
+	}
+	if req.SetSize != nil {
+		if *req.SetSize < 1 || *req.SetSize > models.MaxSetSize {
+			return nil, ErrInvalidSetSize
+		}
+		round.SetSize = *req.SetSize
+	}
+	if req.SetSelection != nil {
+		if !req.SetSelection.Valid() {
+			return nil, ErrInvalidSetSelection
+		}
+		round.SetSelection = *req.SetSelection
+	}
+	if round.SubmissionDeadline.Before(round.OpensAt) ||
+		round.VotingStartsAt.Before(round.SubmissionDeadline) ||
+		round.ClosesAt.Before(round.VotingStartsAt) {
+		return nil, ErrInvalidRoundDates
+	}
+	if err := s.roundRepository.Save(round); err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to update round: %w", err)
+	}
+	return round, nil
+}
+
+// List returns a page of the rounds opened so far, latest first
+func (s *RoundService) List(params models.RoundQueryParams) (*dto.GetRoundsResp, error) {
+	query := config.DB.Model(&models.Round{}).Where("opens_at <= ?", time.Now())
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to count rounds: %w", err)
+	}
+
+	var rounds []models.Round
+	if err := query.Order("opens_at DESC").Limit(params.Limit).Offset(params.Offset).Find(&rounds).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to find rounds: %w", err)
+	}
+
+	resp := dto.GetRoundsResp{Rounds: make([]dto.GetRoundResp, 0, len(rounds)), Total: total}
+	for i := range rounds {
+		resp.Rounds = append(resp.Rounds, roundResp(&rounds[i]))
+	}
+	return &resp, nil
+}
+
+// Location returns the timezone of the schedule
+func (s *RoundService) Location() *time.Location {
+	schedule, err := s.Schedule()
+	if err != nil {
+		log.Println(err)
+		defaultSchedule := models.DefaultRoundSchedule()
+		return defaultSchedule.Location()
+	}
+	return schedule.Location()
+}
+
+func (s *RoundService) findAt(t time.Time) (*models.Round, error) {
+	var round models.Round
+	if err := config.DB.Where("opens_at <= ? AND closes_at > ?", t, t).First(&round).Error; err != nil {
+		return nil, err
+	}
+	return &round, nil
+}
+
+// createRound saves the round unless another instance generated it first
+func (s *RoundService) createRound(round *models.Round) error {
+	return config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(round).Error
+}
+
+func roundResp(round *models.Round) dto.GetRoundResp {
+	return dto.GetRoundResp{
+		ID:                 round.ID,
+		Number:             round.Number,
+		OpensAt:            round.OpensAt,
+		SubmissionDeadline: round.SubmissionDeadline,
+		VotingStartsAt:     round.VotingStartsAt,
+		ClosesAt:           round.ClosesAt,
+		Status:             round.StatusAt(time.Now()),
+		SetSize:            round.SetSize,
+		SetSelection:       round.SetSelection,
+		ClosedAt:           round.ClosedAt,
+	}
+}
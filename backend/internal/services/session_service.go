@@ -0,0 +1,200 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/config"
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// sessionTTL is how long a session lives without being refreshed
+const sessionTTL = 30 * 24 * time.Hour
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrSessionNotFound     = errors.New("session not found")
+)
+
+type SessionService struct {
+	sessionRepository      *repositories.Repository[models.Session]
+	refreshTokenRepository *repositories.Repository[models.RefreshToken]
+}
+
+func NewSessionService(sessionRepo *repositories.Repository[models.Session], refreshTokenRepo *repositories.Repository[models.RefreshToken]) *SessionService {
+	return &SessionService{
+		sessionRepository:      sessionRepo,
+		refreshTokenRepository: refreshTokenRepo,
+	}
+}
+
+// Create opens a session for the device of the request and returns it along
+// with its first refresh token
+func (s *SessionService) Create(c *gin.Context, userID uuid.UUID) (*models.Session, string, error) {
+	now := time.Now()
+	session := models.Session{
+		UserID:     userID,
+		UserAgent:  c.Request.UserAgent(),
+		IP:         c.ClientIP(),
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(sessionTTL),
+	}
+
+	var refreshToken string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		var err error
+		refreshToken, err = createRefreshToken(tx, session.ID)
+		return err
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, "", fmt.Errorf("failed to create session: %w", err)
+	}
+	return &session, refreshToken, nil
+}
+
+// Rotate exchanges a refresh token for a new one. A token presented twice
+// means it leaked, the whole session is then revoked.
+func (s *SessionService) Rotate(refreshToken string) (*models.Session, string, error) {
+	var session models.Session
+	var newRefreshToken string
+	reused := false
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var token models.RefreshToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashToken(refreshToken)).
+			First(&token).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.First(&session, "id = ?", token.SessionID).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		if session.RevokedAt != nil || session.ExpiresAt.Before(now) {
+			return ErrInvalidRefreshToken
+		}
+
+		if token.UsedAt != nil {
+			reused = true
+			return tx.Model(&session).Update("revoked_at", now).Error
+		}
+
+		if err := tx.Model(&token).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&session).Updates(map[string]interface{}{
+			"last_used_at": now,
+			"expires_at":   now.Add(sessionTTL),
+		}).Error; err != nil {
+			return err
+		}
+		newRefreshToken, err = createRefreshToken(tx, session.ID)
+		return err
+	})
+	if reused {
+		log.Printf("Refresh token reused, revoked session %s of user %s", session.ID, session.UserID)
+		return nil, "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		if !errors.Is(err, ErrInvalidRefreshToken) {
+			log.Println(err)
+		}
+		return nil, "", err
+	}
+	return &session, newRefreshToken, nil
+}
+
+// List returns the active sessions of the user, most recently used first
+func (s *SessionService) List(userID uuid.UUID) ([]models.Session, error) {
+	var sessions []models.Session
+	if err := config.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// Revoke signs out the session of the user
+func (s *SessionService) Revoke(userID uuid.UUID, sessionID uuid.UUID) error {
+	result := config.DB.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		log.Println(result.Error)
+		return fmt.Errorf("failed to revoke session: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeAll signs out every session of the user
+func (s *SessionService) RevokeAll(userID uuid.UUID) error {
+	if err := config.DB.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		log.Println(err)
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired removes the sessions which can no longer be refreshed
+func (s *SessionService) DeleteExpired() (int64, error) {
+	var deleted int64
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		expired := tx.Model(&models.Session{}).Select("id").
+			Where("expires_at < ? OR revoked_at IS NOT NULL", time.Now())
+		if err := tx.Where("session_id IN (?)", expired).Delete(&models.RefreshToken{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("expires_at < ? OR revoked_at IS NOT NULL", time.Now()).Delete(&models.Session{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+	return deleted, nil
+}
+
+func createRefreshToken(tx *gorm.DB, sessionID uuid.UUID) (string, error) {
+	value, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	token := models.RefreshToken{
+		SessionID: sessionID,
+		TokenHash: hashToken(value),
+	}
+	if err := tx.Create(&token).Error; err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
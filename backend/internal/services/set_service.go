@@ -2,6 +2,9 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
 	"sort"
 	"strings"
 	"time"
@@ -13,17 +16,40 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/zmb3/spotify/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var (
+	ErrRoundClosed = errors.New("the round is closed, its likes are locked")
+	ErrSetNotFound = errors.New("set not found")
+	// ErrSubmissionsClosed is returned outside of the submission window of the round
+	ErrSubmissionsClosed = errors.New("submissions are closed for the current round")
+	ErrSetTooLarge       = errors.New("too many tracks for the set size of the round")
+	ErrSetExists         = errors.New("a set was already submitted to the current round")
+	// ErrPlaylistMirrorFailed is returned when the submission couldn't be copied
+	// to the Bangr playlist, the sync would otherwise revert it
+	ErrPlaylistMirrorFailed = errors.New("failed to update the Bangr playlist")
+)
+
+// minRoundSets is the number of sets of the round under which house sets are shown
+const minRoundSets = 2
+
 type SetService struct {
-	setRepository    *repositories.Repository[models.Set]
-	tracksRepository *repositories.Repository[models.Track]
+	setRepository      *repositories.Repository[models.Set]
+	tracksRepository   *repositories.Repository[models.Track]
+	leaderboardService *LeaderboardService
+	houseSetService    *HouseSetService
+	roundService       *RoundService
 }
 
-func NewSetService(setRepo *repositories.Repository[models.Set], tracksRepo *repositories.Repository[models.Track]) *SetService {
+func NewSetService(setRepo *repositories.Repository[models.Set], tracksRepo *repositories.Repository[models.Track], leaderboardService *LeaderboardService, houseSetService *HouseSetService, roundService *RoundService) *SetService {
 	return &SetService{
-		setRepository:    setRepo,
-		tracksRepository: tracksRepo,
+		setRepository:      setRepo,
+		tracksRepository:   tracksRepo,
+		leaderboardService: leaderboardService,
+		houseSetService:    houseSetService,
+		roundService:       roundService,
 	}
 }
 
@@ -31,13 +57,10 @@ func (s *SetService) GetSets(c *gin.Context) ([]dto.GetSetResp, error) {
 	setsResp := make([]dto.GetSetResp, 0)
 	user := c.MustGet("user").(*models.User)
 
-	// Calculate last Monday at 1 AM
-	now := time.Now()
-	offset := int(time.Monday - now.Weekday())
-	if offset > 0 {
-		offset = -6
+	round, err := s.roundService.Current()
+	if err != nil {
+		return nil, err
 	}
-	lastMonday := time.Date(now.Year(), now.Month(), now.Day()+offset, 1, 0, 0, 0, now.Location())
 
 	// Get current user's genres
 	var currentUser models.User
@@ -51,7 +74,7 @@ func (s *SetService) GetSets(c *gin.Context) ([]dto.GetSetResp, error) {
 
 	// Get all users and their genres
 	var users []models.User
-	if err := config.DB.Preload("Genres").Find(&users).Error; err != nil {
+	if err := config.DB.Preload("Genres").Where("deletion_scheduled_at IS NULL AND banned_at IS NULL").Find(&users).Error; err != nil {
 		return nil, err
 	}
 
@@ -90,83 +113,141 @@ func (s *SetService) GetSets(c *gin.Context) ([]dto.GetSetResp, error) {
 	for _, um := range userMatches {
 		filteredUserIDs = append(filteredUserIDs, um.User.ID)
 	}
-	sets, err := s.setRepository.FindAllByFilter(map[string]interface{}{"user_id": filteredUserIDs}, "Tracks", "User")
+	filteredSets, err := s.setRepository.FindAllByFilter(map[string]interface{}{"user_id": filteredUserIDs, "round_id": round.ID}, "Tracks", "User")
 	if err != nil {
 		return nil, err
 	}
 
-	// Filter sets based on creation date
-	filteredSets := make([]models.Set, 0)
-	dummySets := make([]models.Set, 0)
-	for _, set := range sets {
-		if set.CreatedAt.After(lastMonday) && set.Dummy == false {
-			filteredSets = append(filteredSets, set)
-		} else if set.Dummy {
-			dummySets = append(dummySets, set)
+	// Fill in with the house sets targeting the viewer while few users submitted a set
+	var houseSets []models.HouseSet
+	if len(filteredSets) < minRoundSets {
+		houseSets, err = s.houseSetService.Active(time.Now(), currentUserGenres)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	if len(filteredSets) < 2 {
-		filteredSets = append(filteredSets, dummySets...)
-	}
-
-	// Get user likes
-	var likes []models.Like
-	config.DB.Model(&models.Like{}).Where("user_id = ?", user.ID).Find(&likes)
-	tracksUserLikesMap := make(map[uuid.UUID]bool)
-	for _, like := range likes {
-		tracksUserLikesMap[like.TrackID] = true
-	}
-
-	// Get likes for each track after last Sunday at midnight
-	var trackLikes []models.Like
-	config.DB.Model(&models.Like{}).Where("created_at >= ?", lastMonday).Find(&trackLikes)
-	trackLikesCountMap := make(map[uuid.UUID]int)
-	for _, like := range trackLikes {
-		trackLikesCountMap[like.TrackID]++
+	// Get the likes of the round and the ones of the user
+	likes, err := findRoundLikes(user.ID, []uuid.UUID{round.ID})
+	if err != nil {
+		return nil, err
 	}
 
 	for _, set := range filteredSets {
-		tracksResp := make([]dto.GetTrackResp, 0)
-		for _, track := range set.Tracks {
-			liked := false
-			if _, ok := tracksUserLikesMap[track.ID]; ok {
-				liked = true
-			}
-			tracksResp = append(tracksResp, dto.GetTrackResp{
-				ID:     track.ID,
-				URI:    track.URI,
-				Name:   track.Name,
-				Artist: track.Artist,
-				Liked:  liked,
-				Likes:  trackLikesCountMap[track.ID], // Total likes for the track
-				ImgURL: track.ImgURL,
-			})
-		}
+		setResp := likes.setResp(set)
 		if set.User.ID == user.ID {
-			setsResp = append([]dto.GetSetResp{
-				{
-					ID:            set.ID,
-					Link:          set.Link,
-					Tracks:        tracksResp,
-					Username:      "Your Bangrs 🔥",
-					ProfilePicURL: set.User.ProfilePicURL,
-				},
-			}, setsResp...)
+			setResp.Username = "Your Bangrs 🔥"
+			setsResp = append([]dto.GetSetResp{setResp}, setsResp...)
 		} else {
-			setsResp = append(setsResp, dto.GetSetResp{
-				ID:            set.ID,
-				Link:          set.Link,
-				Tracks:        tracksResp,
-				Username:      set.User.Username,
-				ProfilePicURL: set.User.ProfilePicURL,
-			})
+			setsResp = append(setsResp, setResp)
 		}
 	}
 
+	for _, houseSet := range houseSets {
+		setsResp = append(setsResp, dto.GetSetResp{
+			ID:            houseSet.ID,
+			Link:          houseSet.Link,
+			Tracks:        likes.tracksResp(&round.ID, houseSet.Tracks),
+			Username:      houseSet.Curator,
+			ProfilePicURL: houseSet.ProfilePicURL,
+			House:         true,
+		})
+	}
+
 	return setsResp, nil
 }
 
+// GetSet returns the set with the likes of its round
+func (s *SetService) GetSet(c *gin.Context, id uuid.UUID) (*dto.GetSetResp, error) {
+	user := c.MustGet("user").(*models.User)
+	var set models.Set
+	err := config.DB.Joins("User").Preload("Tracks").
+		Where(`sets.id = ? AND "User".deletion_scheduled_at IS NULL AND "User".banned_at IS NULL`, id).
+		First(&set).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSetNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to find set: %w", err)
+	}
+
+	roundIDs := make([]uuid.UUID, 0, 1)
+	if set.RoundID != nil {
+		roundIDs = append(roundIDs, *set.RoundID)
+	}
+	likes, err := findRoundLikes(user.ID, roundIDs)
+	if err != nil {
+		return nil, err
+	}
+	resp := likes.setResp(set)
+	return &resp, nil
+}
+
+// GetRoundSets returns a page of the sets submitted to the round
+func (s *SetService) GetRoundSets(c *gin.Context, roundID uuid.UUID, params models.SetQueryParams) (*dto.GetSetsResp, error) {
+	round, err := s.roundService.Get(roundID)
+	if err != nil {
+		return nil, err
+	}
+	return s.findSetsPage(c, config.DB.Where("sets.round_id = ?", round.ID), params)
+}
+
+// GetUserSets returns a page of the sets of the user over the rounds, latest first
+func (s *SetService) GetUserSets(c *gin.Context, userID uuid.UUID, params models.SetQueryParams) (*dto.GetSetsResp, error) {
+	var count int64
+	if err := config.DB.Model(&models.User{}).
+		Where("id = ? AND deletion_scheduled_at IS NULL AND banned_at IS NULL", userID).
+		Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+	if count == 0 {
+		return nil, ErrUserNotFound
+	}
+	return s.findSetsPage(c, config.DB.Where("sets.user_id = ?", userID), params)
+}
+
+// findSetsPage returns the page of the sets matching the filter, from the
+// users still visible, with the likes counted in the round of each set
+func (s *SetService) findSetsPage(c *gin.Context, filter *gorm.DB, params models.SetQueryParams) (*dto.GetSetsResp, error) {
+	user := c.MustGet("user").(*models.User)
+	query := config.DB.Model(&models.Set{}).
+		Joins("JOIN users ON users.id = sets.user_id").
+		Where("users.deletion_scheduled_at IS NULL AND users.banned_at IS NULL").
+		Where(filter)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to count sets: %w", err)
+	}
+
+	var sets []models.Set
+	if err := query.Preload("Tracks").Preload("User").
+		Order("sets.created_at DESC").Limit(params.Limit).Offset(params.Offset).
+		Find(&sets).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to find sets: %w", err)
+	}
+
+	roundIDs := make([]uuid.UUID, 0, len(sets))
+	for _, set := range sets {
+		if set.RoundID != nil {
+			roundIDs = append(roundIDs, *set.RoundID)
+		}
+	}
+	likes, err := findRoundLikes(user.ID, roundIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := dto.GetSetsResp{Sets: make([]dto.GetSetResp, 0, len(sets)), Total: total}
+	for _, set := range sets {
+		resp.Sets = append(resp.Sets, likes.setResp(set))
+	}
+	return &resp, nil
+}
+
 func (s *SetService) ToggleLikeTrack(c *gin.Context, trackID uuid.UUID, params models.LikeQueryParams) error {
 	user := c.MustGet("user").(*models.User)
 	spotifyClient := c.MustGet("spotifyClient").(*spotify.Client)
@@ -176,7 +257,18 @@ func (s *SetService) ToggleLikeTrack(c *gin.Context, trackID uuid.UUID, params m
 	}
 	trackSpotifyID := spotify.ID(strings.Split(track.URI, ":")[2])
 
+	// Likes count for the current round, the ones of ended rounds are locked
+	round, err := s.roundService.Current()
+	if err != nil {
+		return err
+	}
+
 	if params.Liked {
+		set, err := s.findLikedSet(track.ID, params.SetID, round)
+		if err != nil {
+			return err
+		}
+
 		// Add track to Spotify library and save like in the database
 		err = spotifyClient.AddTracksToLibrary(c, trackSpotifyID)
 		if err != nil {
@@ -185,17 +277,69 @@ func (s *SetService) ToggleLikeTrack(c *gin.Context, trackID uuid.UUID, params m
 		like := models.Like{
 			UserID:  user.ID,
 			TrackID: track.ID,
+			RoundID: &round.ID,
+		}
+		if set != nil {
+			like.SetID = &set.ID
 		}
-		if err := config.DB.Save(&like).Error; err != nil {
+		err = config.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&like).Error; err != nil {
+				return err
+			}
+			if set == nil || set.UserID == user.ID {
+				return nil
+			}
+			return s.leaderboardService.ApplyLike(tx, set.UserID, like.CreatedAt, 1)
+		})
+		if err != nil {
 			return err
 		}
 	} else {
+		var current, locked int64
+		if err := config.DB.Model(&models.Like{}).Where("user_id = ? AND track_id = ? AND round_id = ?", user.ID, track.ID, round.ID).
+			Count(&current).Error; err != nil {
+			return err
+		}
+		// The rounds that ended are locked even before the close job froze them
+		ended := config.DB.Model(&models.Round{}).Select("id").Where("closed_at IS NOT NULL OR closes_at <= ?", time.Now())
+		if err := config.DB.Model(&models.Like{}).Where("user_id = ? AND track_id = ?", user.ID, track.ID).
+			Where("round_id IN (?)", ended).
+			Count(&locked).Error; err != nil {
+			return err
+		}
+		// Check before touching the Spotify library, which is not rolled back
+		if current == 0 && locked > 0 {
+			return ErrRoundClosed
+		}
+
 		// Remove track from Spotify library and delete like from the database
 		err = spotifyClient.RemoveTracksFromLibrary(c, trackSpotifyID)
 		if err != nil {
 			return err
 		}
-		if err := config.DB.Where("user_id = ? AND track_id = ?", user.ID, track.ID).Delete(&models.Like{}).Error; err != nil {
+		err = config.DB.Transaction(func(tx *gorm.DB) error {
+			var likes []models.Like
+			if err := tx.Clauses(clause.Returning{}).Where("user_id = ? AND track_id = ? AND round_id = ?", user.ID, track.ID, round.ID).Delete(&likes).Error; err != nil {
+				return err
+			}
+			for _, like := range likes {
+				if like.SetID == nil {
+					continue
+				}
+				var set models.Set
+				if err := tx.First(&set, "id = ?", *like.SetID).Error; err != nil {
+					return err
+				}
+				if set.UserID == user.ID {
+					continue
+				}
+				if err := s.leaderboardService.ApplyLike(tx, set.UserID, like.CreatedAt, -1); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
 			return err
 		}
 	}
@@ -203,13 +347,74 @@ func (s *SetService) ToggleLikeTrack(c *gin.Context, trackID uuid.UUID, params m
 	return nil
 }
 
+// findLikedSet returns the set the track is liked from during the round.
+// The set given by the client is used when it is part of the round and
+// contains the track, otherwise the latest set of the round holding the track
+// is picked. Tracks only found in house sets have no owner to credit and
+// return nil. Sets of ended rounds return ErrRoundClosed, their results are
+// frozen.
+func (s *SetService) findLikedSet(trackID uuid.UUID, setID string, round *models.Round) (*models.Set, error) {
+	query := config.DB.Model(&models.Set{}).
+		Joins("JOIN set_tracks ON set_tracks.set_id = sets.id").
+		Where("set_tracks.track_id = ? AND sets.round_id = ?", trackID, round.ID).
+		Session(&gorm.Session{})
+
+	if setID != "" {
+		id, err := uuid.Parse(setID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid set ID: %w", err)
+		}
+		var set models.Set
+		err = query.Where("sets.id = ?", id).First(&set).Error
+		if err == nil {
+			return &set, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+
+		var ended int64
+		if err := config.DB.Model(&models.Set{}).
+			Joins("JOIN rounds ON rounds.id = sets.round_id").
+			Where("sets.id = ? AND (rounds.closed_at IS NOT NULL OR rounds.closes_at <= ?)", id, time.Now()).
+			Count(&ended).Error; err != nil {
+			return nil, err
+		}
+		if ended > 0 {
+			return nil, ErrRoundClosed
+		}
+	}
+
+	var set models.Set
+	err := query.Order("sets.created_at DESC").First(&set).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &set, nil
+}
+
 func (s *SetService) CreateSet(spotifyUserID string, set models.Set, spotifyClient *spotify.Client) (models.Set, error) {
+	round, err := s.roundService.Current()
+	if err != nil {
+		return models.Set{}, err
+	}
+	var count int64
+	if err := config.DB.Model(&models.Set{}).Where("user_id = ? AND round_id = ?", set.UserID, round.ID).Count(&count).Error; err != nil {
+		return models.Set{}, err
+	}
+	if count > 0 {
+		return models.Set{}, ErrSetExists
+	}
 
 	playlist, err := spotifyClient.CreatePlaylistForUser(context.Background(), spotifyUserID, "My Set 🔥", "Add your favorite song every 3 days to listen to other people's favorite songs!", false, false)
 	if err != nil {
 		return models.Set{}, err
 	}
-	set.Link = playlist.ID.String()
+	set.Link = playlistLink(playlist.ID)
+	set.RoundID = &round.ID
 
 	// Save the set
 	if err := s.setRepository.Save(&set); err != nil {
@@ -217,3 +422,221 @@ func (s *SetService) CreateSet(spotifyUserID string, set models.Set, spotifyClie
 	}
 	return set, nil
 }
+
+// Submit saves the tracks as the set of the user for the current round. Until
+// the deadline a new submission replaces the tracks of the previous one, the
+// likes of the tracks taken out being dropped. The Bangr playlist of the user
+// is updated first to match the set, created reports a first submission.
+func (s *SetService) Submit(c *gin.Context, req dto.PostSubmissionReq) (resp *dto.GetSubmissionResp, created bool, err error) {
+	user := c.MustGet("user").(*models.User)
+	spotifyClient := c.MustGet("spotifyClient").(*spotify.Client)
+
+	round, err := s.roundService.Current()
+	if err != nil {
+		return nil, false, err
+	}
+	if round.StatusAt(time.Now()) != models.RoundStatusSubmissions {
+		return nil, false, ErrSubmissionsClosed
+	}
+	if len(req.TrackURIs) > round.SetSize {
+		return nil, false, fmt.Errorf("%w: at most %d tracks", ErrSetTooLarge, round.SetSize)
+	}
+
+	tracks, err := resolveSpotifyTracks(c, spotifyClient, s.tracksRepository, req.TrackURIs)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The playlist follows the set, the sync reads the set from it until the
+	// deadline. It is updated before the set is saved: failing to update it
+	// cancels the submission, failing to save the set puts its items back.
+	mirrored := user.SpotifyPlaylistLink != ""
+	playlistID := spotify.ID(user.SpotifyPlaylistLink)
+	var previous []spotify.URI
+	if mirrored {
+		items, err := fetchPlaylistItems(c, spotifyClient, playlistID)
+		if err != nil {
+			log.Printf("Couldn't read the playlist of user %s: %v", user.ID, err)
+			return nil, false, fmt.Errorf("%w: %v", ErrPlaylistMirrorFailed, err)
+		}
+		previous = playlistItemURIs(items)
+		uris := make([]spotify.URI, 0, len(tracks))
+		for _, track := range tracks {
+			uris = append(uris, spotify.URI(track.URI))
+		}
+		if _, err := spotifyClient.ReplacePlaylistItems(c, playlistID, uris...); err != nil {
+			log.Printf("Couldn't mirror the submission of user %s to their playlist: %v", user.ID, err)
+			return nil, false, fmt.Errorf("%w: %v", ErrPlaylistMirrorFailed, err)
+		}
+	}
+
+	var set models.Set
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ? AND round_id = ?", user.ID, round.ID).Order("created_at DESC").First(&set).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			set = models.Set{
+				Name:    "My Set 🔥",
+				UserID:  user.ID,
+				RoundID: &round.ID,
+			}
+			if mirrored {
+				set.Link = playlistLink(playlistID)
+			}
+			created = true
+		} else if err != nil {
+			return err
+		}
+		return replaceSetTracks(tx, s.leaderboardService, &set, tracks)
+	})
+	if err != nil {
+		log.Println(err)
+		if mirrored {
+			if _, err := spotifyClient.ReplacePlaylistItems(c, playlistID, previous...); err != nil {
+				log.Printf("Couldn't restore the playlist of user %s: %v", user.ID, err)
+			}
+		}
+		return nil, false, fmt.Errorf("failed to save submission: %w", err)
+	}
+
+	likes, err := findRoundLikes(user.ID, []uuid.UUID{round.ID})
+	if err != nil {
+		return nil, false, err
+	}
+	set.User = *user
+	return &dto.GetSubmissionResp{Set: likes.setResp(set), PlaylistMirrored: mirrored}, created, nil
+}
+
+// playlistLink is the link of the playlist saved on its sets
+func playlistLink(id spotify.ID) string {
+	return "https://open.spotify.com/playlist/" + id.String()
+}
+
+// playlistItemURIs returns the URIs of the items that can be put back in a
+// playlist, up to the 100 items a replace takes. Local files can't be added.
+func playlistItemURIs(items []spotify.PlaylistItem) []spotify.URI {
+	uris := make([]spotify.URI, 0, len(items))
+	for _, item := range items {
+		switch {
+		case item.IsLocal:
+		case item.Track.Track != nil && item.Track.Track.URI != "":
+			uris = append(uris, item.Track.Track.URI)
+		case item.Track.Episode != nil && item.Track.Episode.ID != "":
+			uris = append(uris, spotify.URI("spotify:episode:"+item.Track.Episode.ID.String()))
+		}
+	}
+	if len(uris) > playlistPageSize {
+		log.Printf("playlist has over %d items, only the first ones can be restored", playlistPageSize)
+		uris = uris[:playlistPageSize]
+	}
+	return uris
+}
+
+type roundTrack struct {
+	roundID uuid.UUID
+	trackID uuid.UUID
+}
+
+// roundLikes are the likes of tracks in rounds, and the ones of the viewer
+type roundLikes struct {
+	counts map[roundTrack]int
+	liked  map[roundTrack]bool
+}
+
+func findRoundLikes(viewerID uuid.UUID, roundIDs []uuid.UUID) (*roundLikes, error) {
+	likes := roundLikes{
+		counts: make(map[roundTrack]int),
+		liked:  make(map[roundTrack]bool),
+	}
+	if len(roundIDs) == 0 {
+		return &likes, nil
+	}
+
+	var rows []struct {
+		RoundID uuid.UUID
+		TrackID uuid.UUID
+		Likes   int
+		Liked   bool
+	}
+	if err := config.DB.Raw(`
+		SELECT round_id, track_id, COUNT(id) AS likes, BOOL_OR(user_id = ?) AS liked
+		FROM likes
+		WHERE round_id IN ?
+		GROUP BY round_id, track_id`, viewerID, roundIDs).Scan(&rows).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to count likes: %w", err)
+	}
+	for _, row := range rows {
+		key := roundTrack{roundID: row.RoundID, trackID: row.TrackID}
+		likes.counts[key] = row.Likes
+		likes.liked[key] = row.Liked
+	}
+	return &likes, nil
+}
+
+func (l *roundLikes) tracksResp(roundID *uuid.UUID, tracks []models.Track) []dto.GetTrackResp {
+	tracksResp := make([]dto.GetTrackResp, 0, len(tracks))
+	for _, track := range tracks {
+		var key roundTrack
+		if roundID != nil {
+			key = roundTrack{roundID: *roundID, trackID: track.ID}
+		}
+		tracksResp = append(tracksResp, dto.GetTrackResp{
+			ID:         track.ID,
+			URI:        track.URI,
+			Name:       track.Name,
+			Artist:     track.Artist,
+			Liked:      l.liked[key],
+			Likes:      l.counts[key],
+			ImgURL:     track.ImgURL,
+			PreviewURL: track.PreviewURL,
+		})
+	}
+	return tracksResp
+}
+
+func (l *roundLikes) setResp(set models.Set) dto.GetSetResp {
+	return dto.GetSetResp{
+		ID:            set.ID,
+		Link:          set.Link,
+		Tracks:        l.tracksResp(set.RoundID, set.Tracks),
+		Username:      set.User.Username,
+		ProfilePicURL: set.User.ProfilePicURL,
+		RoundID:       set.RoundID,
+	}
+}
+
+// replaceSetTracks saves the set with the tracks, dropping the likes of the
+// tracks it no longer holds from the standings of its owner. It must run in a
+// transaction.
+func replaceSetTracks(tx *gorm.DB, leaderboardService *LeaderboardService, set *models.Set, tracks []models.Track) error {
+	if err := tx.Save(set).Error; err != nil {
+		return err
+	}
+
+	query := tx.Clauses(clause.Returning{}).Where("set_id = ?", set.ID)
+	if len(tracks) > 0 {
+		trackIDs := make([]uuid.UUID, 0, len(tracks))
+		for _, track := range tracks {
+			trackIDs = append(trackIDs, track.ID)
+		}
+		query = query.Where("track_id NOT IN ?", trackIDs)
+	}
+	var dropped []models.Like
+	if err := query.Delete(&dropped).Error; err != nil {
+		return err
+	}
+	for _, like := range dropped {
+		if like.UserID == set.UserID {
+			continue
+		}
+		if err := leaderboardService.ApplyLike(tx, set.UserID, like.CreatedAt, -1); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Model(set).Association("Tracks").Replace(tracks); err != nil {
+		return err
+	}
+	set.Tracks = tracks
+	return nil
+}
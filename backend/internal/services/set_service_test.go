@@ -0,0 +1,92 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/zmb3/spotify/v2"
+)
+
+func TestToggleLikeTrackFromClosedRound(t *testing.T) {
+	db := testDB(t)
+
+	now := time.Now()
+	closedAt := now.AddDate(0, 0, -7)
+	closed := models.Round{
+		Number:             900001,
+		OpensAt:            now.AddDate(0, 0, -14),
+		SubmissionDeadline: now.AddDate(0, 0, -12),
+		VotingStartsAt:     now.AddDate(0, 0, -10),
+		ClosesAt:           closedAt,
+		ClosedAt:           &closedAt,
+	}
+	current := models.Round{
+		Number:             900002,
+		OpensAt:            closedAt,
+		SubmissionDeadline: now.AddDate(0, 0, 1),
+		VotingStartsAt:     now.AddDate(0, 0, 3),
+		ClosesAt:           now.AddDate(0, 0, 7),
+	}
+	owner := models.User{Username: "closed-round-curator"}
+	liker := models.User{Username: "closed-round-liker"}
+	track := models.Track{Name: "Track", Artist: "Artist", URI: "spotify:track:closedround"}
+	for _, row := range []interface{}{&closed, &current, &owner, &liker, &track} {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatalf("creating %T: %v", row, err)
+		}
+	}
+	set := models.Set{Name: "Set", UserID: owner.ID, RoundID: &closed.ID, Tracks: []models.Track{track}}
+	if err := db.Create(&set).Error; err != nil {
+		t.Fatalf("creating set: %v", err)
+	}
+
+	roundService := NewRoundService(repositories.NewRepository[models.Round](db), repositories.NewRepository[models.RoundSchedule](db))
+	setService := NewSetService(repositories.NewRepository[models.Set](db), repositories.NewRepository[models.Track](db), nil, nil, roundService)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set("user", &liker)
+	c.Set("spotifyClient", spotify.New(http.DefaultClient))
+	err := setService.ToggleLikeTrack(c, track.ID, models.LikeQueryParams{Liked: true, SetID: set.ID.String()})
+	if !errors.Is(err, ErrRoundClosed) {
+		t.Fatalf("got error %v, want %v", err, ErrRoundClosed)
+	}
+
+	var likes int64
+	if err := db.Model(&models.Like{}).Where("user_id = ?", liker.ID).Count(&likes).Error; err != nil {
+		t.Fatalf("counting likes: %v", err)
+	}
+	if likes != 0 {
+		t.Errorf("got %d likes, want none", likes)
+	}
+}
+
+func TestPlaylistItemURIs(t *testing.T) {
+	local := playlistTrack("local", time.Time{})
+	local.IsLocal = true
+	items := []spotify.PlaylistItem{
+		playlistTrack("a", time.Time{}),
+		local,
+		{Track: spotify.PlaylistItemTrack{Episode: &spotify.EpisodePage{ID: "podcast"}}},
+		{},
+		playlistTrack("b", time.Time{}),
+	}
+	want := []spotify.URI{"spotify:track:a", "spotify:episode:podcast", "spotify:track:b"}
+	if got := playlistItemURIs(items); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	items = make([]spotify.PlaylistItem, playlistPageSize+1)
+	for i := range items {
+		items[i] = playlistTrack("a", time.Time{})
+	}
+	if got := playlistItemURIs(items); len(got) != playlistPageSize {
+		t.Errorf("got %d items, want the %d a replace takes", len(got), playlistPageSize)
+	}
+}
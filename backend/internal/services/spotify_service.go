@@ -0,0 +1,35 @@
+package services
+
+import (
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/dto"
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/tokenstore"
+	"github.com/gin-gonic/gin"
+)
+
+type SpotifyService struct {
+	tokenStore *tokenstore.Store
+}
+
+func NewSpotifyService(tokenStore *tokenstore.Store) *SpotifyService {
+	return &SpotifyService{
+		tokenStore: tokenStore,
+	}
+}
+
+// GetToken returns a Spotify access token of the current user for the Web
+// Playback SDK, valid for at least tokenstore.MinLifetime
+func (s *SpotifyService) GetToken(c *gin.Context) (*dto.GetSpotifyTokenResp, error) {
+	user := c.MustGet("user").(*models.User)
+	token, err := s.tokenStore.Token(c, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.GetSpotifyTokenResp{
+		AccessToken: token.AccessToken,
+		ExpiresAt:   token.Expiry,
+		ExpiresIn:   int(time.Until(token.Expiry).Seconds()),
+	}, nil
+}
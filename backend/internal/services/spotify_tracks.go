@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/repositories"
+	"github.com/zmb3/spotify/v2"
+)
+
+var (
+	ErrEpisodeNotAllowed = errors.New("podcast episodes can't be submitted")
+	ErrTrackUnplayable   = errors.New("track is not playable on Spotify")
+	ErrDuplicateTrack    = errors.New("track submitted twice")
+)
+
+// resolveSpotifyTracks looks up the tracks of the URIs on Spotify, in the
+// market of the client, and saves the ones seen for the first time. Every URI
+// must be a distinct track, known and playable on Spotify.
+func resolveSpotifyTracks(ctx context.Context, spotifyClient *spotify.Client, trackRepo *repositories.Repository[models.Track], uris []string) ([]models.Track, error) {
+	ids := make([]spotify.ID, 0, len(uris))
+	seen := make(map[string]bool, len(uris))
+	for _, uri := range uris {
+		if strings.HasPrefix(uri, "spotify:episode:") {
+			return nil, fmt.Errorf("%w: %s", ErrEpisodeNotAllowed, uri)
+		}
+		id, ok := strings.CutPrefix(uri, "spotify:track:")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidTrackURI, uri)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateTrack, uri)
+		}
+		seen[id] = true
+		ids = append(ids, spotify.ID(id))
+	}
+
+	spotifyTracks, err := spotifyClient.GetTracks(ctx, ids, spotify.Market(spotify.MarketFromToken))
+	if err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to get tracks: %w", err)
+	}
+
+	tracks := make([]models.Track, 0, len(spotifyTracks))
+	for i, spotifyTrack := range spotifyTracks {
+		// Spotify answers null for unknown IDs
+		if spotifyTrack == nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidTrackURI, uris[i])
+		}
+		// Playability is only reported along with a market
+		if spotifyTrack.IsPlayable != nil && !*spotifyTrack.IsPlayable {
+			return nil, fmt.Errorf("%w: %s", ErrTrackUnplayable, uris[i])
+		}
+		track, err := findOrCreateTrack(trackRepo, spotifyTrack)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save track: %w", err)
+		}
+		tracks = append(tracks, *track)
+	}
+	return tracks, nil
+}
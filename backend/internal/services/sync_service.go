@@ -0,0 +1,412 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/config"
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/repositories"
+	"github.com/VincentBaron/bangr/backend/internal/tokenstore"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/zmb3/spotify/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	// playlistPageSize is the largest page of playlist items Spotify returns
+	playlistPageSize = 100
+	// maxPlaylistItems bounds the items read from a playlist
+	maxPlaylistItems = 10000
+)
+
+// ErrSetFrozen is returned when syncing a set past the submission deadline
+var ErrSetFrozen = errors.New("the set is frozen since the submission deadline")
+
+// SyncService snapshots the Bangr playlists of the users into sets
+type SyncService struct {
+	userRepository     *repositories.Repository[models.User]
+	setRepository      *repositories.Repository[models.Set]
+	trackRepository    *repositories.Repository[models.Track]
+	userService        *UserService
+	roundService       *RoundService
+	leaderboardService *LeaderboardService
+	tokenStore         *tokenstore.Store
+}
+
+func NewSyncService(userRepo *repositories.Repository[models.User], setRepo *repositories.Repository[models.Set], trackRepo *repositories.Repository[models.Track], userService *UserService, roundService *RoundService, leaderboardService *LeaderboardService, tokenStore *tokenstore.Store) *SyncService {
+	return &SyncService{
+		userRepository:     userRepo,
+		setRepository:      setRepo,
+		trackRepository:    trackRepo,
+		userService:        userService,
+		roundService:       roundService,
+		leaderboardService: leaderboardService,
+		tokenStore:         tokenStore,
+	}
+}
+
+// SyncOptions changes how the users are synced
+type SyncOptions struct {
+	// DryRun computes the changes to the sets without saving anything
+	DryRun bool
+	// Round is the round of the sets, the current one when nil
+	Round *models.Round
+	// IncludeClosed syncs a round whose results are frozen, its new sets get
+	// no likes nor results
+	IncludeClosed bool
+	// Late creates the missing sets past the submission deadline of the
+	// round, as a backfill does
+	Late bool
+}
+
+// SyncResult is the change a sync made, or would make in a dry run, to the
+// set of the user for the round. Added and Removed are track URIs.
+type SyncResult struct {
+	User    *models.User
+	Set     *models.Set
+	Created bool
+	// Frozen is set when the set was left as is since submissions are closed
+	Frozen  bool
+	Added   []string
+	Removed []string
+}
+
+func (r *SyncResult) String() string {
+	switch {
+	case r.Frozen:
+		return fmt.Sprintf("%s: set frozen since the submission deadline", r.User.Username)
+	case r.Created:
+		return fmt.Sprintf("%s: new set [%s]", r.User.Username, strings.Join(r.Added, ", "))
+	case len(r.Added) == 0 && len(r.Removed) == 0:
+		return fmt.Sprintf("%s: unchanged", r.User.Username)
+	}
+	return fmt.Sprintf("%s: added [%s], removed [%s]", r.User.Username, strings.Join(r.Added, ", "), strings.Join(r.Removed, ", "))
+}
+
+// SyncAll syncs the set of every active user
+func (s *SyncService) SyncAll(ctx context.Context, opts SyncOptions) (*JobReport, error) {
+	users, err := s.userRepository.FindAllByFilter(map[string]interface{}{"deletion_scheduled_at": nil, "banned_at": nil})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching users: %w", err)
+	}
+	return s.SyncUsers(ctx, users, opts)
+}
+
+// SyncUsers syncs the sets of the users, a failing user is logged and counted
+// as errored. The users who can't be synced, or whose set is frozen, are skipped.
+func (s *SyncService) SyncUsers(ctx context.Context, users []models.User, opts SyncOptions) (*JobReport, error) {
+	// Every user is synced into the same round, even if it ends during the run
+	if opts.Round == nil {
+		round, err := s.roundService.Current()
+		if err != nil {
+			return nil, err
+		}
+		opts.Round = round
+	}
+
+	report := JobReport{}
+	if opts.Round.ClosedAt != nil && !opts.IncludeClosed {
+		log.Printf("Round %d is closed, skipping its %d users", opts.Round.Number, len(users))
+		report.Skipped = len(users)
+		return &report, nil
+	}
+	for i := range users {
+		user := &users[i]
+		switch {
+		case user.DeletionScheduledAt != nil || user.BannedAt != nil:
+			log.Printf("%s: skipped, account deleted or banned", user.Username)
+			report.Skipped++
+			continue
+		case user.NeedsReauth:
+			log.Printf("%s: skipped, Spotify reauthorization required", user.Username)
+			report.Skipped++
+			continue
+		case user.CreatedAt.After(opts.Round.SubmissionDeadline):
+			log.Printf("%s: skipped, signed up after the round %d", user.Username, opts.Round.Number)
+			report.Skipped++
+			continue
+		}
+
+		result, err := s.SyncUser(ctx, user, opts)
+		if errors.Is(err, tokenstore.ErrNotLinked) || errors.Is(err, tokenstore.ErrReauthRequired) ||
+			errors.Is(err, ErrSubmissionsClosed) {
+			log.Printf("%s: skipped, %v", user.Username, err)
+			report.Skipped++
+			continue
+		}
+		if err != nil {
+			log.Printf("error syncing user %s: %v", user.ID, err)
+			report.Errored++
+			continue
+		}
+		log.Println(result)
+		if result.Frozen {
+			report.Skipped++
+			continue
+		}
+		report.Processed++
+	}
+	return &report, nil
+}
+
+// SyncUser makes the set of the user for the round match the tracks of their
+// playlist, picked as set by the round. The set is created on the first sync
+// of the round and reconciled on the next ones, until the submission
+// deadline. Past it, the missing set is only created for late syncs and
+// closed rounds, ErrSubmissionsClosed is returned otherwise. The items skipped
+// on the way are saved as the sync issues of the user for the round.
+func (s *SyncService) SyncUser(ctx context.Context, user *models.User, opts SyncOptions) (*SyncResult, error) {
+	round := opts.Round
+	if round == nil {
+		current, err := s.roundService.Current()
+		if err != nil {
+			return nil, err
+		}
+		round = current
+	}
+	result := SyncResult{User: user}
+
+	var set models.Set
+	err := config.DB.Preload("Tracks").Where("user_id = ? AND round_id = ?", user.ID, round.ID).First(&set).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		set = models.Set{UserID: user.ID, RoundID: &round.ID}
+		result.Created = true
+	} else if err != nil {
+		return nil, fmt.Errorf("error finding set: %w", err)
+	}
+	result.Set = &set
+	if !time.Now().Before(round.SubmissionDeadline) {
+		if !result.Created {
+			result.Frozen = true
+			return &result, nil
+		}
+		if !opts.Late && !opts.IncludeClosed {
+			return nil, ErrSubmissionsClosed
+		}
+	}
+
+	spotifyClient, err := s.tokenStore.Client(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing Spotify client: %w", err)
+	}
+	if !opts.DryRun {
+		// Keep the tier in sync with upgrades and downgrades of the subscription
+		if err := s.userService.RefreshTier(ctx, user, spotifyClient); err != nil {
+			log.Printf("error refreshing tier of user %s: %v", user.ID, err)
+		}
+	}
+	playlist, err := spotifyClient.GetPlaylist(ctx, spotify.ID(user.SpotifyPlaylistLink))
+	if err != nil {
+		if !opts.DryRun {
+			issue := models.SyncIssue{Reason: models.SyncIssuePlaylistUnavailable, ItemURI: "spotify:playlist:" + user.SpotifyPlaylistLink}
+			if err := saveSyncIssues(user.ID, round.ID, []models.SyncIssue{issue}); err != nil {
+				log.Printf("error saving sync issues of user %s: %v", user.ID, err)
+			}
+		}
+		return nil, fmt.Errorf("error fetching playlist %s: %w", user.SpotifyPlaylistLink, err)
+	}
+
+	items, err := fetchPlaylistItems(ctx, spotifyClient, playlist.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching tracks for playlist %s: %w", playlist.ID, err)
+	}
+	spotifyTracks, issues := selectTracks(items, round)
+
+	// Diff the tracks by URI, the new ones aren't saved yet
+	current := make(map[string]bool, len(set.Tracks))
+	for _, track := range set.Tracks {
+		current[track.URI] = true
+	}
+	selected := make(map[string]bool, len(spotifyTracks))
+	for _, spotifyTrack := range spotifyTracks {
+		uri := string(spotifyTrack.URI)
+		selected[uri] = true
+		if !current[uri] {
+			result.Added = append(result.Added, uri)
+		}
+	}
+	for _, track := range set.Tracks {
+		if !selected[track.URI] {
+			result.Removed = append(result.Removed, track.URI)
+		}
+	}
+	set.Name = playlist.Name
+	set.Link = playlistLink(playlist.ID)
+	if opts.DryRun {
+		return &result, nil
+	}
+
+	if err := saveSyncIssues(user.ID, round.ID, issues); err != nil {
+		log.Printf("error saving sync issues of user %s: %v", user.ID, err)
+	}
+	tracks := make([]models.Track, 0, len(spotifyTracks))
+	for _, spotifyTrack := range spotifyTracks {
+		track, err := findOrCreateTrack(s.trackRepository, spotifyTrack)
+		if err != nil {
+			log.Printf("error saving track %s: %v", spotifyTrack.URI, err)
+			continue
+		}
+		tracks = append(tracks, *track)
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		return replaceSetTracks(tx, s.leaderboardService, &set, tracks)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error saving set of user %s: %w", user.ID, err)
+	}
+	return &result, nil
+}
+
+// Issues returns the sync issues of the user for the current round
+func (s *SyncService) Issues(c *gin.Context) ([]models.SyncIssue, error) {
+	user := c.MustGet("user").(*models.User)
+	round, err := s.roundService.Current()
+	if err != nil {
+		return nil, err
+	}
+
+	issues := make([]models.SyncIssue, 0)
+	if err := config.DB.Where("user_id = ? AND round_id = ?", user.ID, round.ID).
+		Order("position").Find(&issues).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to find sync issues: %w", err)
+	}
+	return issues, nil
+}
+
+// fetchPlaylistItems reads every page of the playlist, up to maxPlaylistItems.
+// Asking for the market of the user reports the tracks that can't be played.
+func fetchPlaylistItems(ctx context.Context, spotifyClient *spotify.Client, playlistID spotify.ID) ([]spotify.PlaylistItem, error) {
+	page, err := spotifyClient.GetPlaylistItems(ctx, playlistID, spotify.Limit(playlistPageSize), spotify.Market(spotify.MarketFromToken))
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]spotify.PlaylistItem, 0, len(page.Items))
+	for {
+		items = append(items, page.Items...)
+		if len(items) >= maxPlaylistItems {
+			log.Printf("playlist %s has over %d items, the others are ignored", playlistID, maxPlaylistItems)
+			return items[:maxPlaylistItems], nil
+		}
+		err := spotifyClient.NextPage(ctx, page)
+		if errors.Is(err, spotify.ErrNoMorePages) {
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// saveSyncIssues replaces the sync issues of the user for the round
+func saveSyncIssues(userID uuid.UUID, roundID uuid.UUID, issues []models.SyncIssue) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND round_id = ?", userID, roundID).Delete(&models.SyncIssue{}).Error; err != nil {
+			return err
+		}
+		if len(issues) == 0 {
+			return nil
+		}
+		for i := range issues {
+			issues[i].UserID = userID
+			issues[i].RoundID = &roundID
+		}
+		return tx.Create(&issues).Error
+	})
+}
+
+// selectTracks picks up to the set size of the round among the items of the
+// playlist, following the set selection of the round. The items that can't
+// make a set are skipped and returned as issues when they would have been picked.
+func selectTracks(items []spotify.PlaylistItem, round *models.Round) ([]*spotify.FullTrack, []models.SyncIssue) {
+	type candidate struct {
+		item     spotify.PlaylistItem
+		position int
+		addedAt  time.Time
+	}
+	candidates := make([]candidate, 0, len(items))
+	for i, item := range items {
+		// Items without a date, added long ago, count as the oldest
+		addedAt, _ := time.Parse(spotify.TimestampLayout, item.AddedAt)
+		if round.SetSelection == models.SetSelectionRound &&
+			(addedAt.Before(round.OpensAt) || !addedAt.Before(round.SubmissionDeadline)) {
+			continue
+		}
+		candidates = append(candidates, candidate{item: item, position: i + 1, addedAt: addedAt})
+	}
+	if round.SetSelection != models.SetSelectionFirst {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].addedAt.After(candidates[j].addedAt)
+		})
+	}
+
+	tracks := make([]*spotify.FullTrack, 0, round.SetSize)
+	issues := make([]models.SyncIssue, 0)
+	for _, c := range candidates {
+		if len(tracks) >= round.SetSize {
+			break
+		}
+		issue := models.SyncIssue{Position: c.position}
+		track, episode := c.item.Track.Track, c.item.Track.Episode
+		switch {
+		case episode != nil:
+			issue.Reason = models.SyncIssueEpisode
+			issue.ItemURI = "spotify:episode:" + episode.ID.String()
+			issue.ItemName = episode.Name
+		case c.item.IsLocal:
+			issue.Reason = models.SyncIssueLocalFile
+			if track != nil {
+				issue.ItemURI = string(track.URI)
+				issue.ItemName = track.Name
+			}
+		// Spotify answers null for the content not available in the market
+		case track == nil || track.ID == "" || (track.IsPlayable != nil && !*track.IsPlayable):
+			issue.Reason = models.SyncIssueUnavailable
+			if track != nil {
+				issue.ItemURI = string(track.URI)
+				issue.ItemName = track.Name
+			}
+		default:
+			tracks = append(tracks, track)
+			continue
+		}
+		issues = append(issues, issue)
+	}
+	return tracks, issues
+}
+
+// findOrCreateTrack returns the track of the Spotify track, saving it on first use
+func findOrCreateTrack(trackRepo *repositories.Repository[models.Track], spotifyTrack *spotify.FullTrack) (*models.Track, error) {
+	trackURI := string(spotifyTrack.URI)
+	track, err := trackRepo.FindByFilter(map[string]interface{}{"uri": trackURI})
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return track, err
+	}
+
+	artistNames := make([]string, 0, len(spotifyTrack.Artists))
+	for _, artist := range spotifyTrack.Artists {
+		artistNames = append(artistNames, artist.Name)
+	}
+	track = &models.Track{
+		ID:         uuid.New(),
+		Name:       spotifyTrack.Name,
+		Artist:     strings.Join(artistNames, ", "),
+		URI:        trackURI,
+		PreviewURL: spotifyTrack.PreviewURL,
+	}
+	if len(spotifyTrack.Album.Images) > 0 {
+		track.ImgURL = spotifyTrack.Album.Images[0].URL
+	}
+	if err := trackRepo.Save(track); err != nil {
+		return nil, err
+	}
+	return track, nil
+}
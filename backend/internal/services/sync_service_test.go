@@ -0,0 +1,112 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/zmb3/spotify/v2"
+)
+
+func playlistTrack(id string, addedAt time.Time) spotify.PlaylistItem {
+	track := &spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{ID: spotify.ID(id), URI: spotify.URI("spotify:track:" + id), Name: id}}
+	return spotify.PlaylistItem{AddedAt: addedAt.Format(spotify.TimestampLayout), Track: spotify.PlaylistItemTrack{Track: track}}
+}
+
+func TestSelectTracks(t *testing.T) {
+	opensAt := time.Date(2026, 10, 12, 1, 0, 0, 0, time.UTC)
+	round := models.Round{OpensAt: opensAt, SubmissionDeadline: opensAt.Add(24 * time.Hour), SetSize: 2}
+	unplayable := playlistTrack("unplayable", opensAt.Add(3*time.Hour))
+	unplayable.Track.Track.IsPlayable = new(bool)
+	local := playlistTrack("local", opensAt.Add(4*time.Hour))
+	local.IsLocal = true
+	episode := spotify.PlaylistItem{
+		AddedAt: opensAt.Add(5 * time.Hour).Format(spotify.TimestampLayout),
+		Track:   spotify.PlaylistItemTrack{Episode: &spotify.EpisodePage{ID: "podcast", Name: "podcast"}},
+	}
+	undated := playlistTrack("undated", time.Time{})
+	undated.AddedAt = ""
+
+	tests := []struct {
+		name       string
+		selection  models.SetSelection
+		items      []spotify.PlaylistItem
+		wantTracks []string
+		wantIssues []models.SyncIssueReason
+	}{
+		{
+			name:      "first tracks of the playlist",
+			selection: models.SetSelectionFirst,
+			items: []spotify.PlaylistItem{
+				playlistTrack("a", opensAt.Add(time.Hour)),
+				playlistTrack("b", opensAt.Add(2*time.Hour)),
+				playlistTrack("c", opensAt.Add(3*time.Hour)),
+			},
+			wantTracks: []string{"a", "b"},
+		},
+		{
+			name:      "most recent tracks, the undated ones last",
+			selection: models.SetSelectionRecent,
+			items: []spotify.PlaylistItem{
+				undated,
+				playlistTrack("a", opensAt.Add(-time.Hour)),
+				playlistTrack("b", opensAt.Add(2*time.Hour)),
+			},
+			wantTracks: []string{"b", "a"},
+		},
+		{
+			name:      "tracks added during the submissions",
+			selection: models.SetSelectionRound,
+			items: []spotify.PlaylistItem{
+				playlistTrack("before", opensAt.Add(-time.Minute)),
+				playlistTrack("a", opensAt),
+				playlistTrack("at-deadline", round.SubmissionDeadline),
+				undated,
+			},
+			wantTracks: []string{"a"},
+		},
+		{
+			name:      "skipped items are reported",
+			selection: models.SetSelectionRecent,
+			items: []spotify.PlaylistItem{
+				playlistTrack("a", opensAt.Add(time.Hour)),
+				unplayable,
+				local,
+				episode,
+				{AddedAt: opensAt.Add(2 * time.Hour).Format(spotify.TimestampLayout)},
+				playlistTrack("b", opensAt.Add(30*time.Minute)),
+				playlistTrack("c", opensAt),
+			},
+			wantTracks: []string{"a", "b"},
+			wantIssues: []models.SyncIssueReason{models.SyncIssueEpisode, models.SyncIssueLocalFile, models.SyncIssueUnavailable, models.SyncIssueUnavailable},
+		},
+		{
+			name:       "empty playlist",
+			selection:  models.SetSelectionFirst,
+			wantTracks: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			round := round
+			round.SetSelection = tt.selection
+			tracks, issues := selectTracks(tt.items, &round)
+
+			gotTracks := make([]string, 0, len(tracks))
+			for _, track := range tracks {
+				gotTracks = append(gotTracks, track.Name)
+			}
+			if !reflect.DeepEqual(gotTracks, tt.wantTracks) {
+				t.Errorf("got tracks %v, want %v", gotTracks, tt.wantTracks)
+			}
+			var gotIssues []models.SyncIssueReason
+			for _, issue := range issues {
+				gotIssues = append(gotIssues, issue.Reason)
+			}
+			if !reflect.DeepEqual(gotIssues, tt.wantIssues) {
+				t.Errorf("got issues %v, want %v", gotIssues, tt.wantIssues)
+			}
+		})
+	}
+}
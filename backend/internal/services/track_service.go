@@ -0,0 +1,150 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/VincentBaron/bangr/backend/internal/config"
+	"github.com/VincentBaron/bangr/backend/internal/dto"
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTrackNotFound  = errors.New("track not found")
+	ErrInvalidRoundID = errors.New("invalid round id")
+)
+
+type TrackService struct {
+	trackRepository *repositories.Repository[models.Track]
+}
+
+func NewTrackService(trackRepo *repositories.Repository[models.Track]) *TrackService {
+	return &TrackService{
+		trackRepository: trackRepo,
+	}
+}
+
+// Get returns the track with its likes in each round it was submitted to or
+// liked in, latest first
+func (s *TrackService) Get(c *gin.Context, id uuid.UUID) (*dto.GetTrackDetailsResp, error) {
+	user := c.MustGet("user").(*models.User)
+	track, err := s.findTrack(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var rounds []models.Round
+	if err := config.DB.Where(`id IN (
+			SELECT sets.round_id FROM sets
+			JOIN set_tracks ON set_tracks.set_id = sets.id
+			JOIN users ON users.id = sets.user_id
+			WHERE set_tracks.track_id = @track
+				AND users.deletion_scheduled_at IS NULL AND users.banned_at IS NULL
+		) OR id IN (SELECT round_id FROM likes WHERE track_id = @track)`,
+		map[string]interface{}{"track": track.ID}).
+		Order("opens_at DESC").Find(&rounds).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to find rounds: %w", err)
+	}
+
+	roundIDs := make([]uuid.UUID, 0, len(rounds))
+	for _, round := range rounds {
+		roundIDs = append(roundIDs, round.ID)
+	}
+	likes, err := findRoundLikes(user.ID, roundIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	if err := config.DB.Model(&models.Like{}).Where("track_id = ?", track.ID).Count(&total).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to count likes: %w", err)
+	}
+
+	resp := dto.GetTrackDetailsResp{
+		ID:         track.ID,
+		URI:        track.URI,
+		Name:       track.Name,
+		Artist:     track.Artist,
+		ImgURL:     track.ImgURL,
+		PreviewURL: track.PreviewURL,
+		Likes:      int(total),
+		Rounds:     make([]dto.TrackRoundEntry, 0, len(rounds)),
+	}
+	for i := range rounds {
+		key := roundTrack{roundID: rounds[i].ID, trackID: track.ID}
+		resp.Rounds = append(resp.Rounds, dto.TrackRoundEntry{
+			Round: roundResp(&rounds[i]),
+			Likes: likes.counts[key],
+			Liked: likes.liked[key],
+		})
+	}
+	return &resp, nil
+}
+
+// GetLikes returns a page of the likers of the track, latest first. Users who
+// hide their likes are only counted, unless the viewer is one of them.
+func (s *TrackService) GetLikes(c *gin.Context, id uuid.UUID, params models.TrackLikesQueryParams) (*dto.GetTrackLikesResp, error) {
+	user := c.MustGet("user").(*models.User)
+	track, err := s.findTrack(id)
+	if err != nil {
+		return nil, err
+	}
+
+	query := config.DB.Model(&models.Like{}).
+		Joins("JOIN users ON users.id = likes.user_id").
+		Where("likes.track_id = ?", track.ID).
+		Where("users.deletion_scheduled_at IS NULL AND users.banned_at IS NULL")
+	if params.RoundID != "" {
+		roundID, err := uuid.Parse(params.RoundID)
+		if err != nil {
+			return nil, ErrInvalidRoundID
+		}
+		query = query.Where("likes.round_id = ?", roundID)
+	}
+
+	query = query.Session(&gorm.Session{})
+
+	var hidden int64
+	if err := query.
+		Where("users.show_likes = false AND users.id <> ?", user.ID).
+		Count(&hidden).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to count hidden likes: %w", err)
+	}
+
+	visible := query.Where("(users.show_likes = true OR users.id = ?)", user.ID).Session(&gorm.Session{})
+	var total int64
+	if err := visible.Count(&total).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to count likes: %w", err)
+	}
+
+	entries := make([]dto.TrackLikeEntry, 0)
+	if err := visible.
+		Select("users.id AS user_id, users.username, users.profile_pic_url, likes.round_id, likes.created_at AS liked_at").
+		Order("likes.created_at DESC").Limit(params.Limit).Offset(params.Offset).
+		Scan(&entries).Error; err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to find likes: %w", err)
+	}
+
+	return &dto.GetTrackLikesResp{Likes: entries, Total: total, Hidden: hidden}, nil
+}
+
+func (s *TrackService) findTrack(id uuid.UUID) (*models.Track, error) {
+	track, err := s.trackRepository.FindByFilter(map[string]interface{}{"id": id})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTrackNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find track: %w", err)
+	}
+	return track, nil
+}
@@ -1,8 +1,10 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/VincentBaron/bangr/backend/internal/config"
 	"github.com/VincentBaron/bangr/backend/internal/dto"
@@ -10,6 +12,7 @@ import (
 	"github.com/VincentBaron/bangr/backend/internal/repositories"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/zmb3/spotify/v2"
 )
 
 type UserService struct {
@@ -25,14 +28,10 @@ func NewUserService(userRepo *repositories.Repository[models.User], genreRepo *r
 }
 
 func (s *UserService) Me(c *gin.Context) (*dto.GetUSerResp, error) {
+	// The user is the one authenticated by the middleware, never the one of a header
+	current := c.MustGet("user").(*models.User)
 
-	userID := c.GetHeader("UserID")
-	if userID == "" {
-		log.Println("UserID header not found")
-		return nil, fmt.Errorf("failed to get userID")
-	}
-
-	user, err := s.userRepository.FindByFilter(map[string]interface{}{"id": userID}, "Genres")
+	user, err := s.userRepository.FindByFilter(map[string]interface{}{"id": current.ID}, "Genres")
 	if err != nil {
 		log.Println(err)
 		return nil, fmt.Errorf("failed to find user: %w", err)
@@ -48,23 +47,27 @@ func (s *UserService) Me(c *gin.Context) (*dto.GetUSerResp, error) {
 	}
 
 	userResp := dto.GetUSerResp{
-		ID:            user.ID,
-		Username:      user.Username,
-		ProfilePicURL: user.ProfilePicURL,
-		Genres:        genres,
+		ID:                    user.ID,
+		Username:              user.Username,
+		ProfilePicURL:         user.ProfilePicURL,
+		Genres:                genres,
+		SpotifyLinked:         user.SpotifyUserID != "",
+		HasPassword:           user.Password != "",
+		Tier:                  user.Tier,
+		SpotifyReauthRequired: user.NeedsReauth,
+		DeletionScheduledAt:   user.DeletionScheduledAt,
+		Role:                  user.Role,
+		ShowLikes:             user.ShowLikes,
 	}
 
 	return &userResp, nil
 }
 
 func (s *UserService) UpdateMe(c *gin.Context, params dto.PatchUserReq) (*dto.GetUSerResp, error) {
-	userID := c.GetHeader("UserID")
-	if userID == "" {
-		log.Println("UserID header not found")
-		return nil, fmt.Errorf("failed to get userID")
-	}
+	// The user is the one authenticated by the middleware, never the one of a header
+	current := c.MustGet("user").(*models.User)
 
-	user, err := s.userRepository.FindByFilter(map[string]interface{}{"id": userID}, "Genres")
+	user, err := s.userRepository.FindByFilter(map[string]interface{}{"id": current.ID}, "Genres")
 	if err != nil {
 		log.Println(err)
 		return nil, fmt.Errorf("failed to find user: %w", err)
@@ -81,6 +84,10 @@ func (s *UserService) UpdateMe(c *gin.Context, params dto.PatchUserReq) (*dto.Ge
 		}
 	}
 
+	if params.ShowLikes != nil {
+		user.ShowLikes = *params.ShowLikes
+	}
+
 	if err := s.userRepository.Save(user); err != nil {
 		log.Println(err)
 		return nil, fmt.Errorf("failed to update user: %w", err)
@@ -92,10 +99,17 @@ func (s *UserService) UpdateMe(c *gin.Context, params dto.PatchUserReq) (*dto.Ge
 	}
 
 	userResp := dto.GetUSerResp{
-		ID:            user.ID,
-		Username:      user.Username,
-		ProfilePicURL: user.ProfilePicURL,
-		Genres:        genresNames,
+		ID:                    user.ID,
+		Username:              user.Username,
+		ProfilePicURL:         user.ProfilePicURL,
+		Genres:                genresNames,
+		SpotifyLinked:         user.SpotifyUserID != "",
+		HasPassword:           user.Password != "",
+		Tier:                  user.Tier,
+		SpotifyReauthRequired: user.NeedsReauth,
+		DeletionScheduledAt:   user.DeletionScheduledAt,
+		Role:                  user.Role,
+		ShowLikes:             user.ShowLikes,
 	}
 
 	return &userResp, nil
@@ -115,3 +129,23 @@ func (s *UserService) GetGenres(c *gin.Context) ([]models.GenreName, error) {
 
 	return genresNames, nil
 }
+
+// RefreshTier updates the tier of the user from their Spotify subscription
+func (s *UserService) RefreshTier(ctx context.Context, user *models.User, spotifyClient *spotify.Client) error {
+	spotifyUser, err := spotifyClient.CurrentUser(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+
+	now := time.Now()
+	user.Tier = models.TierFromProduct(spotifyUser.Product)
+	user.TierCheckedAt = &now
+	if err := config.DB.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"tier":            user.Tier,
+		"tier_checked_at": now,
+	}).Error; err != nil {
+		log.Println(err)
+		return fmt.Errorf("failed to update tier: %w", err)
+	}
+	return nil
+}
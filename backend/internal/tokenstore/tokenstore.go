@@ -0,0 +1,169 @@
+// Package tokenstore hands out Spotify clients for Bangr users, refreshing and
+// persisting their tokens in a single place.
+package tokenstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/VincentBaron/bangr/backend/internal/config"
+	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/google/uuid"
+	"github.com/zmb3/spotify/v2"
+	spotifyauth "github.com/zmb3/spotify/v2/auth"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// MinLifetime is the validity left under which tokens are refreshed, so the
+// tokens handed out do not expire while in use
+const MinLifetime = 5 * time.Minute
+
+var (
+	// ErrNotLinked is returned for users without a Spotify account
+	ErrNotLinked = errors.New("Spotify account not linked")
+	// ErrReauthRequired is returned once Spotify revoked the grant of the user,
+	// who must authorize Bangr again
+	ErrReauthRequired = errors.New("Spotify authorization revoked, reauthorization required")
+)
+
+type Store struct {
+	db          *gorm.DB
+	oauthConfig *oauth2.Config
+}
+
+func New(db *gorm.DB) *Store {
+	return &Store{
+		db: db,
+		oauthConfig: &oauth2.Config{
+			ClientID:     config.Conf.SpotifyClientID,
+			ClientSecret: config.Conf.SpotifyClientSecret,
+			Endpoint: oauth2.Endpoint{
+				TokenURL: spotifyauth.TokenURL,
+			},
+		},
+	}
+}
+
+// Token returns a token of the user valid for at least MinLifetime
+func (s *Store) Token(ctx context.Context, userID uuid.UUID) (*oauth2.Token, error) {
+	token, err := s.find(s.db.WithContext(ctx), userID)
+	if err != nil {
+		return nil, err
+	}
+	if token.Expiry.After(time.Now().Add(MinLifetime)) {
+		return toOAuth2(token), nil
+	}
+	return s.refresh(ctx, userID, false)
+}
+
+// Refresh renews the token of the user even when still valid, finding out
+// early whether Spotify revoked the grant
+func (s *Store) Refresh(ctx context.Context, userID uuid.UUID) (*oauth2.Token, error) {
+	return s.refresh(ctx, userID, true)
+}
+
+// Client returns a Spotify client of the user. The client keeps going through
+// the store, so long running jobs never use an expired token.
+func (s *Store) Client(ctx context.Context, userID uuid.UUID) (*spotify.Client, error) {
+	token, err := s.Token(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	src := oauth2.ReuseTokenSource(token, &tokenSource{ctx: ctx, store: s, userID: userID})
+	return spotify.New(oauth2.NewClient(ctx, src)), nil
+}
+
+// refresh renews the token under a lock of the user, so that concurrent
+// requests and jobs neither refresh twice nor overwrite each other's refresh
+// token. Unless forced, a token still valid is kept.
+func (s *Store) refresh(ctx context.Context, userID uuid.UUID, force bool) (*oauth2.Token, error) {
+	var refreshed *oauth2.Token
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "spotify_token:"+userID.String()).Error; err != nil {
+			return fmt.Errorf("failed to lock token: %w", err)
+		}
+
+		// Another request may have refreshed it while we waited for the lock
+		token, err := s.find(tx, userID)
+		if err != nil {
+			return err
+		}
+		if !force && token.Expiry.After(time.Now().Add(MinLifetime)) {
+			refreshed = toOAuth2(token)
+			return nil
+		}
+
+		// Only hand the refresh token so that it is used even before expiry
+		newToken, err := s.oauthConfig.TokenSource(ctx, &oauth2.Token{RefreshToken: token.RefreshToken}).Token()
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant" {
+			return ErrReauthRequired
+		}
+		if err != nil {
+			return fmt.Errorf("failed to refresh token: %w", err)
+		}
+
+		token.AccessToken = newToken.AccessToken
+		token.Expiry = newToken.Expiry
+		// Spotify only sometimes rotates the refresh token
+		if newToken.RefreshToken != "" {
+			token.RefreshToken = newToken.RefreshToken
+		}
+		if err := tx.Save(token).Error; err != nil {
+			return fmt.Errorf("failed to save token: %w", err)
+		}
+		refreshed = toOAuth2(token)
+		log.Printf("Token refreshed for user %s", userID)
+		return nil
+	})
+	if errors.Is(err, ErrReauthRequired) {
+		log.Printf("Spotify grant revoked for user %s", userID)
+		if err := s.db.Model(&models.User{}).Where("id = ?", userID).Update("needs_reauth", true).Error; err != nil {
+			log.Println(err)
+		}
+		return nil, ErrReauthRequired
+	}
+	if err != nil {
+		return nil, err
+	}
+	return refreshed, nil
+}
+
+func (s *Store) find(db *gorm.DB, userID uuid.UUID) (*models.SpotifyToken, error) {
+	var token models.SpotifyToken
+	err := db.Where("user_id = ?", userID).Order("updated_at DESC").First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotLinked
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find token: %w", err)
+	}
+	if token.RefreshToken == "" {
+		return nil, ErrNotLinked
+	}
+	return &token, nil
+}
+
+func toOAuth2(token *models.SpotifyToken) *oauth2.Token {
+	return &oauth2.Token{
+		AccessToken:  token.AccessToken,
+		TokenType:    "Bearer",
+		RefreshToken: token.RefreshToken,
+		Expiry:       token.Expiry,
+	}
+}
+
+// tokenSource goes back to the store whenever the client's token expires
+type tokenSource struct {
+	ctx    context.Context
+	store  *Store
+	userID uuid.UUID
+}
+
+func (t *tokenSource) Token() (*oauth2.Token, error) {
+	return t.store.Token(t.ctx, t.userID)
+}
@@ -4,13 +4,16 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/VincentBaron/bangr/backend/internal/config"
 	"github.com/VincentBaron/bangr/backend/internal/handlers"
 	"github.com/VincentBaron/bangr/backend/internal/middlewares"
 	"github.com/VincentBaron/bangr/backend/internal/models"
+	"github.com/VincentBaron/bangr/backend/internal/ratelimit"
 	"github.com/VincentBaron/bangr/backend/internal/repositories"
 	"github.com/VincentBaron/bangr/backend/internal/services"
+	"github.com/VincentBaron/bangr/backend/internal/tokenstore"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
@@ -40,12 +43,17 @@ func init() {
 func main() {
 	// Set up the Gin router
 	r := gin.New()
+	// The client IP keying the rate limits is only read from trusted headers
+	if err := r.SetTrustedProxies(config.Conf.TrustedProxies); err != nil {
+		log.Fatalf("Error configuring trusted proxies: %v", err)
+	}
+	r.TrustedPlatform = config.Conf.TrustedPlatform
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowOrigins = []string{os.Getenv("FRONTEND_URL")}
 	corsConfig.AllowCredentials = true
 	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
 	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "UserID"}
-	corsConfig.ExposeHeaders = []string{"Authorization", "UserID", "SpotifyAuthorization"}
+	corsConfig.ExposeHeaders = []string{"Authorization", "UserID"}
 
 	r.Use(cors.New(corsConfig))
 
@@ -55,14 +63,41 @@ func main() {
 	trackRepository := repositories.NewRepository[models.Track](config.DB)
 	genreRepository := repositories.NewRepository[models.Genre](config.DB)
 	likesRepository := repositories.NewRepository[models.Like](config.DB)
+	oauthStateRepository := repositories.NewRepository[models.OAuthState](config.DB)
+	sessionRepository := repositories.NewRepository[models.Session](config.DB)
+	refreshTokenRepository := repositories.NewRepository[models.RefreshToken](config.DB)
+	dataExportRepository := repositories.NewRepository[models.DataExport](config.DB)
+	auditEventRepository := repositories.NewRepository[models.AuditEvent](config.DB)
+	loginAttemptRepository := repositories.NewRepository[models.LoginAttempt](config.DB)
+	cronRunRepository := repositories.NewRepository[models.CronRun](config.DB)
+	houseSetRepository := repositories.NewRepository[models.HouseSet](config.DB)
+	roundRepository := repositories.NewRepository[models.Round](config.DB)
+	roundScheduleRepository := repositories.NewRepository[models.RoundSchedule](config.DB)
+
+	// Initialize the Spotify token store shared by services and middlewares
+	tokenStore := tokenstore.New(config.DB)
 
 	// Initialize services
-	authService := services.NewAuthService(userRepository, genreRepository)
-	setService := services.NewSetService(setRepository, trackRepository)
-	playerService := services.NewPlayerService()
+	oauthStateService := services.NewOAuthStateService(oauthStateRepository)
+	sessionService := services.NewSessionService(sessionRepository, refreshTokenRepository)
+	auditService := services.NewAuditService(auditEventRepository)
+	loginGuardService := services.NewLoginGuardService(loginAttemptRepository, auditService)
+	authService := services.NewAuthService(userRepository, genreRepository, oauthStateService, sessionService, loginGuardService)
+	roundService := services.NewRoundService(roundRepository, roundScheduleRepository)
+	roundResultService := services.NewRoundResultService(roundService)
+	leaderboardService := services.NewLeaderboardService(trackRepository, likesRepository, roundService)
+	houseSetService := services.NewHouseSetService(houseSetRepository, genreRepository, trackRepository)
+	setService := services.NewSetService(setRepository, trackRepository, leaderboardService, houseSetService, roundService)
 	userService := services.NewUserService(userRepository, genreRepository)
-	leaderboardService := services.NewLeaderboardService(trackRepository, likesRepository)
+	playerService := services.NewPlayerService(userService)
 	prizePoolService := services.NewPrizePoolService(userRepository)
+	spotifyService := services.NewSpotifyService(tokenStore)
+	accountService := services.NewAccountService(userRepository, sessionService, leaderboardService, tokenStore)
+	exportService := services.NewExportService(userRepository, setRepository, dataExportRepository)
+	syncService := services.NewSyncService(userRepository, setRepository, trackRepository, userService, roundService, leaderboardService, tokenStore)
+	cronRunService := services.NewCronRunService(cronRunRepository)
+	trackService := services.NewTrackService(trackRepository)
+	adminService := services.NewAdminService(userRepository, sessionService, syncService, auditService)
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService)
@@ -71,27 +106,94 @@ func main() {
 	userHandler := handlers.NewUserHandler(userService)
 	leaderBoardHandler := handlers.NewLeaderboardHandler(leaderboardService)
 	prizePoolHandler := handlers.NewPrizePoolHandler(prizePoolService)
+	spotifyHandler := handlers.NewSpotifyHandler(spotifyService)
+	accountHandler := handlers.NewAccountHandler(accountService)
+	exportHandler := handlers.NewExportHandler(exportService)
+	adminHandler := handlers.NewAdminHandler(adminService, cronRunService, houseSetService, roundService)
+	roundHandler := handlers.NewRoundHandler(roundService, roundResultService)
+	trackHandler := handlers.NewTrackHandler(trackService)
+	syncHandler := handlers.NewSyncHandler(syncService)
 
 	// Initialize middlewares
-	middleware := middlewares.NewMiddleware(userRepository)
+	middleware := middlewares.NewMiddleware(userRepository, sessionRepository, tokenStore)
+	rateLimit := middlewares.NewRateLimitMiddleware(config.NewRateLimiter(config.DB))
+
+	// Rate limits of the route groups, each can be overridden in the configs
+	r.Use(rateLimit.Limit("api", middlewares.RouteLimits{
+		PerIP: config.RateLimit("api.ip", ratelimit.Limit{Requests: 300, Per: time.Minute}),
+	}))
+	loginLimit := rateLimit.Limit("login", middlewares.RouteLimits{
+		PerIP:       config.RateLimit("login.ip", ratelimit.Limit{Requests: 20, Per: time.Minute}),
+		PerUsername: config.RateLimit("login.username", ratelimit.Limit{Requests: 5, Per: time.Minute}),
+	})
+	signupLimit := rateLimit.Limit("signup", middlewares.RouteLimits{
+		PerIP: config.RateLimit("signup.ip", ratelimit.Limit{Requests: 10, Per: time.Hour}),
+	})
+	authLimit := rateLimit.Limit("auth", middlewares.RouteLimits{
+		PerIP: config.RateLimit("auth.ip", ratelimit.Limit{Requests: 30, Per: time.Minute}),
+	})
 
 	// Set up routes with handlers
-	r.POST("/signup", authHandler.Signup)
-	r.POST("/login", authHandler.Login)
-	r.GET("/callback", authHandler.CallbackHandler)
+	r.POST("/signup", signupLimit, authHandler.Signup)
+	r.POST("/login", loginLimit, authHandler.Login)
+	r.GET("/callback", authLimit, authHandler.CallbackHandler)
+	r.POST("/auth/refresh", authLimit, authHandler.Refresh)
+	r.POST("/auth/spotify", authLimit, authHandler.SpotifyLogin)
+	r.POST("/auth/spotify/exchange", authLimit, authHandler.SpotifyExchange)
+	r.POST("/logout", middleware.RequireAuth, authHandler.Logout)
+	r.POST("/logout-all", middleware.RequireAuth, authHandler.LogoutAll)
 	r.GET("/sets", middleware.RequireAuth, setHandler.GetSets)
-	r.POST("/sets", middleware.RequireAuth, setHandler.CreateSet)
-	r.GET("/player", middleware.RequireAuth, playerHandler.Player)
-	r.PUT("/tracks/:id/like", middleware.RequireAuth, setHandler.ToggleLikeTrack)
+	r.POST("/sets", middleware.RequireAuth, middleware.RequireSpotify, setHandler.CreateSet)
+	r.GET("/sets/:id", middleware.RequireAuth, setHandler.GetSet)
+	r.GET("/tracks/:id", middleware.RequireAuth, trackHandler.GetTrack)
+	r.GET("/tracks/:id/likes", middleware.RequireAuth, trackHandler.GetTrackLikes)
+	r.GET("/player", middleware.RequireAuth, middleware.RequireSpotify, playerHandler.Player)
+	r.GET("/spotify/token", middleware.RequireAuth, middleware.RequireSpotify, spotifyHandler.GetToken)
+	r.PUT("/tracks/:id/like", middleware.RequireAuth, middleware.RequireSpotify, setHandler.ToggleLikeTrack)
 	r.GET("/me", middleware.RequireAuth, userHandler.GetMe)
 	r.PATCH("/me", middleware.RequireAuth, userHandler.UpdateMe)
+	r.DELETE("/me", middleware.RequireAuth, accountHandler.DeleteMe)
+	r.POST("/me/restore", middleware.RequireAuth, accountHandler.RestoreMe)
+	r.GET("/me/sync-issues", middleware.RequireAuth, syncHandler.GetSyncIssues)
+	r.GET("/me/export", middleware.RequireAuth, exportHandler.Export)
+	r.GET("/me/export/:id", middleware.RequireAuth, exportHandler.GetExport)
+	r.POST("/me/spotify/link", middleware.RequireAuth, authHandler.LinkSpotify)
+	r.POST("/me/spotify/relink", middleware.RequireAuth, authHandler.RelinkSpotify)
+	r.DELETE("/me/spotify", middleware.RequireAuth, authHandler.UnlinkSpotify)
+	r.GET("/me/sessions", middleware.RequireAuth, authHandler.GetSessions)
+	r.DELETE("/me/sessions/:id", middleware.RequireAuth, authHandler.DeleteSession)
+	r.GET("/rounds", middleware.RequireAuth, roundHandler.ListRounds)
+	r.GET("/rounds/current", middleware.RequireAuth, roundHandler.GetCurrentRound)
+	// Tracks are checked on Spotify and mirrored to the Bangr playlist of the user
+	r.POST("/rounds/current/submission", middleware.RequireAuth, middleware.RequireSpotify, setHandler.Submit)
+	r.GET("/rounds/:id/results", middleware.RequireAuth, roundHandler.GetRoundResults)
+	r.GET("/rounds/:id/sets", middleware.RequireAuth, setHandler.GetRoundSets)
+	r.GET("/users/:id/sets", middleware.RequireAuth, setHandler.GetUserSets)
 	r.GET("/genres", middleware.RequireAuth, userHandler.GetGenres)
 	// Get leaderboard
 	r.GET("/leaderboard", middleware.RequireAuth, leaderBoardHandler.GetLeaderboard)
+	r.GET("/leaderboard/me", middleware.RequireAuth, leaderBoardHandler.GetMyStanding)
 
 	// Prize Pool routes
 	r.GET("/prize-pool", middleware.RequireAuth, prizePoolHandler.GetPrizePool)
 
+	// Admin routes
+	admin := r.Group("/admin", middleware.RequireAuth, middleware.RequireRole(models.UserRoleAdmin))
+	admin.GET("/users", adminHandler.ListUsers)
+	admin.GET("/users/:id", adminHandler.GetUser)
+	admin.POST("/users/:id/ban", adminHandler.BanUser)
+	admin.DELETE("/users/:id/ban", adminHandler.UnbanUser)
+	admin.POST("/users/:id/resync", adminHandler.ResyncUser)
+	admin.GET("/cron-runs", adminHandler.ListCronRuns)
+	admin.GET("/house-sets", adminHandler.ListHouseSets)
+	// Tracks are looked up on Spotify with the account of the admin
+	admin.POST("/house-sets", middleware.RequireSpotify, adminHandler.CreateHouseSet)
+	admin.PATCH("/house-sets/:id", middleware.RequireSpotify, adminHandler.UpdateHouseSet)
+	admin.DELETE("/house-sets/:id", adminHandler.DeleteHouseSet)
+	admin.GET("/round-schedule", adminHandler.GetRoundSchedule)
+	admin.PUT("/round-schedule", adminHandler.UpdateRoundSchedule)
+	admin.PATCH("/rounds/:id", adminHandler.UpdateRound)
+
 	// Start the server
 	log.Printf("Server started at http://localhost:8080...")
 	log.Fatal(http.ListenAndServe("0.0.0.0:8080", r))
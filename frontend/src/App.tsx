@@ -8,6 +8,7 @@ import AuthDialog from "./components/AuthDialog";
 import { Toaster } from "./components/ui/toaster";
 import "./styles/fonts.css";
 import "./styles/background-animation.css";
+import { exchangeLoginCode } from "./api/api";
 
 export default function App() {
   const [isLoggedIn, setIsLoggedIn] = useState<boolean | null>(false);
@@ -15,14 +16,24 @@ export default function App() {
   const [authMode, setAuthMode] = useState<"login" | "signup">("login");
 
   useEffect(() => {
+    const loginCode = new URLSearchParams(window.location.search).get(
+      "login_code"
+    );
+    if (loginCode) {
+      window.history.replaceState({}, "", window.location.pathname);
+      exchangeLoginCode(loginCode)
+        .then(() => setIsLoggedIn(true))
+        .catch((error) => console.error("Spotify sign in failed", error));
+      return;
+    }
+
     const checkUserStatus = () => {
-      const spotifyAuthorization = localStorage.getItem("SpotifyAuthorization");
-      if (!spotifyAuthorization) {
+      const authorization = localStorage.getItem("Authorization");
+      if (!authorization) {
         localStorage.removeItem("UserID");
         localStorage.removeItem("SpotifyAuthorization");
-        localStorage.removeItem("Authorization");
       }
-      setIsLoggedIn(!!spotifyAuthorization);
+      setIsLoggedIn(!!authorization);
     };
 
     checkUserStatus();
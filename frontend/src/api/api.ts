@@ -21,20 +21,41 @@ api.interceptors.request.use((config) => {
 api.interceptors.response.use((response) => {
   // Check if the backend sent updated tokens in the headers
   const authorization = response.headers["authorization"];
-  const spotifyToken = response.headers["spotifyauthorization"];
   const userID = response.headers["userid"];
 
   if (authorization) {
     localStorage.setItem("Authorization", authorization);
   }
-  if (spotifyToken) {
-    localStorage.setItem("SpotifyAuthorization", spotifyToken);
-  }
   if (userID) {
     localStorage.setItem("UserID", userID);
   }
 
   return response; // Return the response for further processing
+}, async (error) => {
+  // Access tokens are short lived, refresh once and replay the request
+  const original = error.config;
+  const refreshToken = localStorage.getItem("RefreshToken");
+  if (error.response?.status === 401 && refreshToken && !original._retried) {
+    original._retried = true;
+    try {
+      const response = await api.post("/auth/refresh", {
+        refresh_token: refreshToken,
+      });
+      localStorage.setItem("RefreshToken", response.data.refresh_token);
+      return api(original);
+    } catch {
+      localStorage.removeItem("RefreshToken");
+    }
+  }
+  // Spotify revoked the grant, send the user through the authorization again
+  if (
+    error.response?.data?.code === "spotify_reauth_required" &&
+    window.confirm("Your Spotify access expired, reconnect your account?")
+  ) {
+    const response = await relinkSpotify();
+    window.location.href = response.data.url;
+  }
+  return Promise.reject(error);
 });
 
 // Fetch genres
@@ -81,6 +102,12 @@ export const activatePlayer = async (deviceId: string, config = {}) => {
   return response; // Return the player activation response
 };
 
+// Fetch a short-lived Spotify token for the Web Playback SDK
+export const fetchSpotifyToken = async (config = {}) => {
+  const response = api.get("/spotify/token", config);
+  return response;
+};
+
 // Fetch sets
 export const fetchSets = async (config = {}) => {
   const response = api.get("/sets", config);
@@ -102,16 +129,36 @@ export const playTrack = async (
 
 // login
 export const login = async (username: string, password: string) => {
-  const response = api.post(
+  const response = await api.post(
     "/login",
     { username, password },
     {
       withCredentials: true,
     }
   );
+  localStorage.setItem("RefreshToken", response.data.refresh_token);
   return response; // Return the login response data
 };
 
+// Start a passwordless sign in with Spotify
+export const spotifyLogin = async () => {
+  const response = api.post("/auth/spotify");
+  return response;
+};
+
+// Exchange the code the Spotify callback redirected with for a session
+export const exchangeLoginCode = async (code: string) => {
+  const response = await api.post("/auth/spotify/exchange", { code });
+  localStorage.setItem("RefreshToken", response.data.refresh_token);
+  return response;
+};
+
+// logout revokes the current session
+export const logout = async () => {
+  const response = api.post("/logout");
+  return response;
+};
+
 // signup
 export const signup = async (
   username: string,
@@ -138,4 +185,118 @@ export const fetchPrizePool = async () => {
   return response;
 };
 
+// Renew the Spotify authorization of the current user
+export const relinkSpotify = async (config = {}) => {
+  const response = api.post("/me/spotify/relink", {}, config);
+  return response;
+};
+
+// Schedule the deletion of the current account, it can be restored during the grace period
+export const deleteAccount = async (config = {}) => {
+  const response = api.delete("/me", config);
+  return response;
+};
+
+// Cancel the scheduled deletion of the current account
+export const restoreAccount = async (config = {}) => {
+  const response = api.post("/me/restore", {}, config);
+  return response;
+};
+
+// Request the personal data archive, large exports answer 202 with an id to poll
+export const exportData = async (config = {}) => {
+  const response = api.get("/me/export", { responseType: "blob", ...config });
+  return response;
+};
+
+export const fetchDataExport = async (id: string, config = {}) => {
+  const response = api.get(`/me/export/${id}`, {
+    responseType: "blob",
+    ...config,
+  });
+  return response;
+};
+
+// The round open now, with its deadlines and status
+export const fetchCurrentRound = async (config = {}) => {
+  const response = api.get("/rounds/current", config);
+  return response;
+};
+
+// The final rankings of a closed round, with its track of the week and top curator
+export const fetchRoundResults = async (id: string, config = {}) => {
+  const response = api.get(`/rounds/${id}/results`, config);
+  return response;
+};
+
+// Rounds opened so far, latest first
+export const fetchRounds = async (limit = 20, offset = 0, config = {}) => {
+  const response = api.get("/rounds", { params: { limit, offset }, ...config });
+  return response;
+};
+
+export const fetchRoundSets = async (
+  id: string,
+  limit = 20,
+  offset = 0,
+  config = {}
+) => {
+  const response = api.get(`/rounds/${id}/sets`, {
+    params: { limit, offset },
+    ...config,
+  });
+  return response;
+};
+
+// Archive of the sets of a user over the rounds, latest first
+export const fetchUserSets = async (
+  id: string,
+  limit = 20,
+  offset = 0,
+  config = {}
+) => {
+  const response = api.get(`/users/${id}/sets`, {
+    params: { limit, offset },
+    ...config,
+  });
+  return response;
+};
+
+export const fetchSet = async (id: string, config = {}) => {
+  const response = api.get(`/sets/${id}`, config);
+  return response;
+};
+
+// A track with its likes in every round it appeared in
+export const fetchTrack = async (id: string, config = {}) => {
+  const response = api.get(`/tracks/${id}`, config);
+  return response;
+};
+
+// Users who liked the track, the ones hiding their likes are only counted
+export const fetchTrackLikes = async (
+  id: string,
+  params: { round_id?: string; limit?: number; offset?: number } = {},
+  config = {}
+) => {
+  const response = api.get(`/tracks/${id}/likes`, { params, ...config });
+  return response;
+};
+
+// Submit or edit the set of the current round until the deadline, with Spotify track URIs
+export const submitSet = async (trackUris: string[], config = {}) => {
+  const response = api.post(
+    "/rounds/current/submission",
+    { track_uris: trackUris },
+    config
+  );
+  return response;
+};
+
+// Items of the Bangr playlist the last sync of the round skipped, with the reason
+export const fetchSyncIssues = async (config = {}) => {
+  const response = api.get("/me/sync-issues", config);
+  return response;
+};
+
 export default api;
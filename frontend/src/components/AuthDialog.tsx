@@ -11,7 +11,7 @@ import { Button } from "@/components/ui/button";
 import { Input } from "@/components/ui/input";
 import { Label } from "@/components/ui/label";
 import { Badge } from "@/components/ui/badge";
-import { login, signup } from "@/api/api";
+import { login, signup, spotifyLogin } from "@/api/api";
 import { ArrowLeft } from "lucide-react";
 
 const musicGenres = [
@@ -71,6 +71,17 @@ const AuthDialog: React.FC<AuthDialogProps> = ({ authMode }) => {
       });
   };
 
+  const handleSpotifyLogin = () => {
+    setLoginError(null);
+    spotifyLogin()
+      .then((response) => {
+        window.location.href = response.data.url;
+      })
+      .catch(() => {
+        setLoginError("Spotify sign in failed. Please try again.");
+      });
+  };
+
   const handleSignupSubmit = (e: React.FormEvent) => {
     e.preventDefault();
     if (signupStep === "credentials") {
@@ -210,6 +221,13 @@ const AuthDialog: React.FC<AuthDialogProps> = ({ authMode }) => {
                 >
                   Login
                 </Button>
+                <Button
+                  type="button"
+                  onClick={handleSpotifyLogin}
+                  className="w-full bg-white/5 hover:bg-white/10 text-white border border-white/10 rounded-lg py-2 text-sm font-medium transition-colors"
+                >
+                  Continue with Spotify
+                </Button>
               </form>
             </TabsContent>
 
@@ -9,6 +9,7 @@ import {
   updateUserGenres,
   fetchLeaderboard,
   fetchPrizePool,
+  logout,
 } from "@/api/api";
 import { Menu, LogOut, CircleX, Check, ChevronDown } from "lucide-react";
 import { FeedbackDialog } from "@/components/FeedbackDialog";
@@ -49,7 +50,7 @@ const Header: React.FC = () => {
           fetchPrizePool(),
         ]);
         setAllGenres(genres.data);
-        setLeaderboardData(leaderboard.data);
+        setLeaderboardData(leaderboard.data.entries);
         setPrizePoolData(prizePool.data);
       } catch (error) {
         console.error("Failed to fetch data", error);
@@ -89,8 +90,14 @@ const Header: React.FC = () => {
   //   }
   // };
 
-  const handleLogout = () => {
+  const handleLogout = async () => {
+    try {
+      await logout();
+    } catch (error) {
+      console.error("Failed to revoke session", error);
+    }
     localStorage.removeItem("Authorization");
+    localStorage.removeItem("RefreshToken");
     localStorage.removeItem("SpotifyAuthorization");
     localStorage.removeItem("UserID");
     setUser(null);
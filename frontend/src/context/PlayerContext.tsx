@@ -5,7 +5,7 @@ import React, {
   useRef,
   useState,
 } from "react";
-import { activatePlayer } from "@/api/api";
+import { activatePlayer, fetchSpotifyToken } from "@/api/api";
 
 interface PlayerContextProps {
   player: Spotify.Player | null;
@@ -41,13 +41,15 @@ export const PlayerProvider: React.FC<{ children: React.ReactNode }> = ({
     document.body.appendChild(script);
 
     window.onSpotifyWebPlaybackSDKReady = () => {
-      const access_token: string = localStorage.getItem(
-        "SpotifyAuthorization"
-      ) as string;
       const player = new window.Spotify.Player({
         name: "Web Playback SDK Quick Start Player",
         getOAuthToken: (cb: (token: string) => void) => {
-          cb(access_token);
+          // The SDK asks again whenever the token expires
+          fetchSpotifyToken({ withCredentials: true })
+            .then((response) => cb(response.data.access_token))
+            .catch((error) =>
+              console.error("Failed to fetch Spotify token", error)
+            );
         },
       });
 